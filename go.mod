@@ -0,0 +1,3 @@
+module github.com/hargettp/go-rb
+
+go 1.21
@@ -0,0 +1,183 @@
+package redblack
+
+//=============================================================================
+//
+// Augmented trees
+//
+//=============================================================================
+
+/*
+A monoid summarizing the entries of a tree; Combine must be associative,
+and combining any aggregate with Identity must leave it unchanged
+*/
+type Monoid interface {
+	/*
+		Return the aggregate of no entries at all
+	*/
+	Identity() interface{}
+	/*
+		Return the aggregate of all entries summarized by a, followed by
+		all entries summarized by b
+	*/
+	Combine(a, b interface{}) interface{}
+	/*
+		Return the aggregate of a single entry
+	*/
+	Measure(key Key, value Value) interface{}
+}
+
+/*
+Implement this interface instead of LLRBImpl to have the tree keep, in every
+node, the aggregate of all entries in that node's subtree.  The tree
+recomputes a node's aggregate whenever its key, value or children change
+(including during rotations), always after recomputing any changed children.
+*/
+type AugmentedLLRBImpl interface {
+	LLRBImpl
+	/*
+		Return the monoid used to compute aggregates
+	*/
+	Monoid() Monoid
+}
+
+/*
+Nodes of augmented trees must implement this interface to hold the aggregate
+for their subtree
+*/
+type AugmentedNodeImpl interface {
+	NodeImpl
+	Aggregate() interface{}
+	SetAggregate(a interface{})
+}
+
+/*
+A red-black tree that can summarize any range of its keys in logarithmic time
+*/
+type AugmentedLLRB interface {
+	LLRB
+	/*
+		Return the aggregate of all entries with keys between low and
+		high (inclusive)
+	*/
+	Aggregate(low, high Key) interface{}
+}
+
+type augmentedTree struct {
+	LLRB
+	monoid Monoid
+}
+
+type augmentedLLRB struct {
+	memoryLLRB
+	monoid Monoid
+}
+
+type augmentedNode struct {
+	memoryNode
+	aggregate interface{}
+}
+
+/*
+Create a new, empty in-memory tree that aggregates its entries using the
+provided monoid
+*/
+func NewAugmentedLLRB(monoid Monoid) AugmentedLLRB {
+	return NewAugmentedRedBlackTree(&augmentedLLRB{monoid: monoid})
+}
+
+/*
+Create a new augmented red-black tree using the provided implementation
+*/
+func NewAugmentedRedBlackTree(impl AugmentedLLRBImpl) AugmentedLLRB {
+	return &augmentedTree{NewRedBlackTree(impl), impl.Monoid()}
+}
+
+func (tree *augmentedTree) Clone() LLRB {
+	return &augmentedTree{tree.LLRB.Clone(), tree.monoid}
+}
+
+func (tree *augmentedTree) Aggregate(low, high Key) interface{} {
+	m := tree.monoid
+	// the first node found within the range splits it in two: everything
+	// from low in its left subtree, and everything up to high in its right
+	h := tree.Root()
+	for h != nil {
+		if h.Key().Compare(low) < 0 {
+			h = h.Right()
+		} else if h.Key().Compare(high) > 0 {
+			h = h.Left()
+		} else {
+			break
+		}
+	}
+	if h == nil {
+		return m.Identity()
+	}
+	a := m.Combine(tree.from(h.Left(), low), m.Measure(h.Key(), h.Value()))
+	return m.Combine(a, tree.upTo(h.Right(), high))
+}
+
+/*
+Return the aggregate of all entries under h with keys not less than low
+*/
+func (tree *augmentedTree) from(h Node, low Key) interface{} {
+	m := tree.monoid
+	a := m.Identity()
+	for h != nil {
+		if h.Key().Compare(low) < 0 {
+			h = h.Right()
+		} else {
+			a = m.Combine(m.Combine(m.Measure(h.Key(), h.Value()), aggregate(h.Right(), m)), a)
+			h = h.Left()
+		}
+	}
+	return a
+}
+
+/*
+Return the aggregate of all entries under h with keys not greater than high
+*/
+func (tree *augmentedTree) upTo(h Node, high Key) interface{} {
+	m := tree.monoid
+	a := m.Identity()
+	for h != nil {
+		if h.Key().Compare(high) > 0 {
+			h = h.Left()
+		} else {
+			a = m.Combine(a, m.Combine(aggregate(h.Left(), m), m.Measure(h.Key(), h.Value())))
+			h = h.Right()
+		}
+	}
+	return a
+}
+
+func aggregate(h Node, m Monoid) interface{} {
+	if h == nil {
+		return m.Identity()
+	}
+	return h.(*node).NodeImpl.(AugmentedNodeImpl).Aggregate()
+}
+
+// LLRB implementation
+
+func (tree *augmentedLLRB) NewNodeImpl(key Key, value Value) NodeImpl {
+	return &augmentedNode{memoryNode: memoryNode{key: key, value: value, color: RED}}
+}
+
+func (tree *augmentedLLRB) NewLLRBImpl() LLRBImpl {
+	return &augmentedLLRB{monoid: tree.monoid}
+}
+
+func (tree *augmentedLLRB) Monoid() Monoid {
+	return tree.monoid
+}
+
+// Node implementation
+
+func (h *augmentedNode) Aggregate() interface{} {
+	return h.aggregate
+}
+
+func (h *augmentedNode) SetAggregate(a interface{}) {
+	h.aggregate = a
+}
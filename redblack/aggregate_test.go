@@ -0,0 +1,133 @@
+package redblack
+
+import "math/rand"
+import "testing"
+
+// sums the keys of a tree
+type sumMonoid struct{}
+
+func (m sumMonoid) Identity() interface{} {
+	return 0
+}
+
+func (m sumMonoid) Combine(a, b interface{}) interface{} {
+	return a.(int) + b.(int)
+}
+
+func (m sumMonoid) Measure(key Key, value Value) interface{} {
+	return int(key.(IntKey))
+}
+
+// concatenates the values of a tree, and so is sensitive to order
+type concatMonoid struct{}
+
+func (m concatMonoid) Identity() interface{} {
+	return ""
+}
+
+func (m concatMonoid) Combine(a, b interface{}) interface{} {
+	return a.(string) + b.(string)
+}
+
+func (m concatMonoid) Measure(key Key, value Value) interface{} {
+	return value.String() + ","
+}
+
+func TestAggregateSum(t *testing.T) {
+	lots := 100
+	tree := NewAugmentedLLRB(sumMonoid{})
+	for i := 1; i <= lots; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	allOk := checkAggregates(tree, sumMonoid{})
+	for low := -5; low <= lots+5; low += 3 {
+		for high := low; high <= lots+5; high += 7 {
+			expected := 0
+			for i := low; i <= high; i++ {
+				if i >= 1 && i <= lots {
+					expected += i
+				}
+			}
+			if sum := tree.Aggregate(IntKey(low), IntKey(high)); sum != expected {
+				log.Error("Expected sum %v for keys %v-%v, saw %v", expected, low, high, sum)
+				allOk = false
+			}
+		}
+	}
+	if sum := tree.Aggregate(IntKey(10), IntKey(5)); sum != 0 {
+		log.Error("Expected empty sum for reversed range, saw %v", sum)
+		allOk = false
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
+
+func TestAggregateOrder(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tree := NewAugmentedLLRB(concatMonoid{})
+	keys := make(map[int]bool)
+	allOk := true
+	for i := 0; i < 500; i++ {
+		key := random.Intn(100)
+		switch random.Intn(6) {
+		case 0:
+			tree.Delete(IntKey(key))
+			delete(keys, key)
+		case 1:
+			tree.DeleteRange(IntKey(key), IntKey(key+5))
+			for k := key; k <= key+5; k++ {
+				delete(keys, k)
+			}
+		case 2:
+			if k, _ := tree.PopMin(); k != nil {
+				delete(keys, int(k.(IntKey)))
+			}
+		default:
+			tree.Insert(IntKey(key), StringValue(IntKey(key).String()))
+			keys[key] = true
+		}
+		allOk = checkAggregates(tree, concatMonoid{}) && allOk
+		low := random.Intn(100)
+		high := low + random.Intn(30)
+		expected := ""
+		for k := low; k <= high; k++ {
+			if keys[k] {
+				expected += IntKey(k).String() + ","
+			}
+		}
+		if found := tree.Aggregate(IntKey(low), IntKey(high)); found != expected {
+			log.Error("Expected %v for keys %v-%v, saw %v", expected, low, high, found)
+			allOk = false
+		}
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+func checkAggregates(tree LLRB, m Monoid) bool {
+	// every node must hold the aggregate of its subtree, computed in order
+	var expected func(h Node) interface{}
+	expected = func(h Node) interface{} {
+		if h == nil {
+			return m.Identity()
+		}
+		a := m.Combine(expected(h.Left()), m.Measure(h.Key(), h.Value()))
+		return m.Combine(a, expected(h.Right()))
+	}
+	allOk := true
+	visitNodes(tree.Root(), func(h Node) {
+		if h != nil && aggregate(h, m) != expected(h) {
+			log.Error("Node %v has aggregate %v, expected %v", h.Key(), aggregate(h, m), expected(h))
+			allOk = false
+		}
+	})
+	return allOk
+}
@@ -0,0 +1,142 @@
+package redblack
+
+//=============================================================================
+//
+// Copy-on-write clones
+//
+//=============================================================================
+
+/*
+Implement this interface in addition to LLRBImpl to allow trees using the
+implementation to be cloned cheaply; trees using other implementations are
+cloned by copying every node.  The nodes of a cloned tree are shared between
+the clone and the original until one of them changes, so they must not
+depend on belonging to a particular LLRBImpl.
+*/
+type CloneableLLRBImpl interface {
+	LLRBImpl
+	/*
+		Create a new, empty implementation of the same kind, to hold the
+		root of a clone
+	*/
+	NewLLRBImpl() LLRBImpl
+}
+
+/*
+Identifies the tree that may change a node in place; every other tree must
+copy the node first.  Not empty, so that each one allocated has a distinct
+address.
+*/
+type owner struct {
+	_ byte
+}
+
+func (tree *llrb) Clone() LLRB {
+	impl, ok := tree.LLRBImpl.(CloneableLLRBImpl)
+	if !ok {
+		return tree.deepCopy()
+	}
+	clone := &llrb{LLRBImpl: impl.NewLLRBImpl(), monoid: tree.monoid, owner: &owner{}}
+	clone.SetRoot(tree.Root())
+	// every existing node is now shared, so neither tree may change them
+	tree.owner = &owner{}
+	return clone
+}
+
+/*
+Copy every node into a new in-memory tree of the same shape, for trees whose
+nodes may belong to their implementation and so cannot be shared
+*/
+func (tree *llrb) deepCopy() LLRB {
+	var impl LLRBImpl = &memoryLLRB{}
+	if tree.monoid != nil {
+		impl = &augmentedLLRB{monoid: tree.monoid}
+	} else if tree.hashed() {
+		impl = &merkleLLRB{}
+	}
+	clone := &llrb{LLRBImpl: impl, monoid: tree.monoid, owner: &owner{}}
+	var copyNodes func(h Node) Node
+	copyNodes = func(h Node) Node {
+		if h == nil {
+			return nil
+		}
+		c := clone.copyNode(h)
+		c.SetLeft(copyNodes(h.Left()))
+		c.SetRight(copyNodes(h.Right()))
+		return c
+	}
+	clone.SetRoot(copyNodes(tree.Root()))
+	return clone
+}
+
+/*
+Return true if the nodes of this tree hold Merkle hashes
+*/
+func (tree *llrb) hashed() bool {
+	var h NodeImpl
+	if tree.Root() != nil {
+		h = tree.Root().(*node).NodeImpl
+	} else {
+		// an empty tree has no node to look at, so make one
+		h = tree.NewNodeImpl(nil, nil)
+	}
+	_, ok := h.(MerkleNodeImpl)
+	return ok
+}
+
+/*
+Return h if this tree may change it in place, or else a copy of h that it
+may change; callers must link the returned node in place of h
+*/
+func (tree *llrb) own(h Node) Node {
+	if h == nil || h.(*node).owner == tree.owner {
+		return h
+	}
+	if tree.stats != nil {
+		tree.stats.allocations.Add(1)
+	}
+	c := tree.copyNode(h)
+	c.SetLeft(h.Left())
+	c.SetRight(h.Right())
+	return c
+}
+
+/*
+Return a new node owned by this tree with the key, value, color, aggregate
+and hash of h, but no children
+*/
+func (tree *llrb) copyNode(h Node) Node {
+	c := &node{tree.NewNodeImpl(h.Key(), h.Value()), tree.owner}
+	c.SetColor(h.Color())
+	if augmented, ok := c.NodeImpl.(AugmentedNodeImpl); ok {
+		augmented.SetAggregate(h.(*node).NodeImpl.(AugmentedNodeImpl).Aggregate())
+	}
+	if hashed, ok := c.NodeImpl.(MerkleNodeImpl); ok {
+		hashed.SetHash(merkleHash(h))
+	}
+	return c
+}
+
+/*
+Make sure this tree may change both children of h, which it must already
+own, in place
+*/
+func (tree *llrb) ownChildren(h Node) {
+	if l := tree.own(h.Left()); l != h.Left() {
+		h.SetLeft(l)
+	}
+	if r := tree.own(h.Right()); r != h.Right() {
+		h.SetRight(r)
+	}
+}
+
+/*
+Color h black, copying it first if it is red and not owned by this tree
+*/
+func (tree *llrb) blacken(h Node) Node {
+	if isRed(h) {
+		h = tree.own(h)
+		h.SetColor(BLACK)
+	}
+	return h
+}
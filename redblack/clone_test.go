@@ -0,0 +1,155 @@
+package redblack
+
+import "bytes"
+import "math/rand"
+import "testing"
+
+func TestClone(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	clone := tree.Clone()
+	if clone.Root() != tree.Root() {
+		log.Error("Expected clone to share the root of the original")
+		t.Fail()
+	}
+	clone.Insert(IntKey(50), StringValue("changed"))
+	clone.Insert(IntKey(101), StringValue("101"))
+	clone.Delete(IntKey(1))
+	clone.DeleteRange(IntKey(70), IntKey(80))
+	tree.Delete(IntKey(100))
+	tree.PopMin()
+	if tree.Size() != 98 || clone.Size() != 89 {
+		log.Error("Expected sizes 98 and 89, saw %v and %v", tree.Size(), clone.Size())
+		t.Fail()
+	}
+	if tree.Search(IntKey(50)).String() != "50" || clone.Search(IntKey(50)).String() != "changed" {
+		log.Error("Expected only the clone to see the changed value")
+		t.Fail()
+	}
+	if tree.Search(IntKey(75)) == nil || clone.Search(IntKey(75)) != nil {
+		log.Error("Expected only the clone to have deleted key 75")
+		t.Fail()
+	}
+	if tree.Search(IntKey(100)) != nil || clone.Search(IntKey(100)) == nil {
+		log.Error("Expected only the original to have deleted key 100")
+		t.Fail()
+	}
+	if !checkBalance(tree) || !checkBalance(clone) {
+		t.Fail()
+	}
+}
+
+func TestCloneRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	trees := []LLRB{NewLLRB()}
+	expected := []map[IntKey]string{make(map[IntKey]string)}
+	for op := 0; op < 5000; op++ {
+		i := random.Intn(len(trees))
+		tree, contents := trees[i], expected[i]
+		k := IntKey(random.Intn(100))
+		switch random.Intn(10) {
+		case 0:
+			if len(trees) < 8 {
+				trees = append(trees, tree.Clone())
+				copied := make(map[IntKey]string)
+				for key, value := range contents {
+					copied[key] = value
+				}
+				expected = append(expected, copied)
+			}
+		case 1, 2, 3:
+			tree.Delete(k)
+			delete(contents, k)
+		case 4:
+			high := k + IntKey(random.Intn(10))
+			tree.DeleteRange(k, high)
+			for key := k; key <= high; key++ {
+				delete(contents, key)
+			}
+		default:
+			value := IntKey(op).String()
+			tree.Insert(k, StringValue(value))
+			contents[k] = value
+		}
+		for j, tree := range trees {
+			if err := Verify(tree); err != nil || tree.Size() != len(expected[j]) {
+				log.Error("Tree %v failed after operation %v: %v, size %v, expected %v", j, op, err, tree.Size(), len(expected[j]))
+				t.FailNow()
+			}
+		}
+	}
+	for j, tree := range trees {
+		for key, value := range expected[j] {
+			if found := tree.Search(key); found == nil || found.String() != value {
+				log.Error("Tree %v has value %v for key %v, expected %v", j, found, key, value)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestCloneAugmented(t *testing.T) {
+	tree := NewNumericTree()
+	for i := 1; i <= 10; i++ {
+		tree.Insert(IntKey(i), IntValue(i))
+	}
+	clone, ok := tree.Clone().(NumericTree)
+	if !ok {
+		log.Error("Expected clone of numeric tree to be a numeric tree")
+		t.FailNow()
+	}
+	clone.Insert(IntKey(5), IntValue(100))
+	clone.Delete(IntKey(10))
+	if tree.Sum(IntKey(1), IntKey(10)) != 55 || clone.Sum(IntKey(1), IntKey(10)) != 140 {
+		log.Error("Expected sums 55 and 140, saw %v and %v", tree.Sum(IntKey(1), IntKey(10)), clone.Sum(IntKey(1), IntKey(10)))
+		t.Fail()
+	}
+	s := NewSetOf(IntKey(1), IntKey(2), IntKey(3))
+	copied := s.Clone()
+	copied.Remove(IntKey(2))
+	if s.String() != "{1 2 3}" || copied.String() != "{1 3}" {
+		log.Error("Expected sets {1 2 3} and {1 3}, saw %v and %v", s, copied)
+		t.Fail()
+	}
+}
+
+func TestCloneUncloneable(t *testing.T) {
+	tree := NewAugmentedRedBlackTree(uncloneableAugmented{&augmentedLLRB{monoid: numericMonoid{}}})
+	for i := 1; i <= 10; i++ {
+		tree.Insert(IntKey(i), IntValue(i))
+	}
+	original, clone := &numericTree{tree}, &numericTree{tree.Clone().(AugmentedLLRB)}
+	clone.Insert(IntKey(5), IntValue(100))
+	if err := Verify(clone); err != nil || original.Sum(IntKey(1), IntKey(10)) != 55 || clone.Sum(IntKey(1), IntKey(10)) != 150 {
+		log.Error("Expected sums 55 and 150, saw %v and %v (%v)", original.Sum(IntKey(1), IntKey(10)), clone.Sum(IntKey(1), IntKey(10)), err)
+		t.Fail()
+	}
+	hashed := NewMerkleRedBlackTree(uncloneableImpl{&merkleLLRB{}})
+	for _, copied := range []MerkleTree{hashed.Clone().(MerkleTree), nil} {
+		if copied == nil {
+			for i := 1; i <= 10; i++ {
+				hashed.Insert(IntKey(i), IntValue(i))
+			}
+			copied = hashed.Clone().(MerkleTree)
+		}
+		before := hashed.RootHash()
+		copied.Insert(IntKey(5), IntValue(100))
+		if err := Verify(copied); err != nil || bytes.Equal(before, copied.RootHash()) || !bytes.Equal(before, hashed.RootHash()) {
+			log.Error("Expected copied Merkle tree to hash its own changes: %v", err)
+			t.Fail()
+		}
+	}
+}
+
+/*
+Hide NewLLRBImpl, so trees using these must be cloned by copying
+*/
+type uncloneableImpl struct {
+	LLRBImpl
+}
+
+type uncloneableAugmented struct {
+	AugmentedLLRBImpl
+}
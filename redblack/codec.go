@@ -0,0 +1,355 @@
+package redblack
+
+import "encoding/binary"
+import "encoding/hex"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "math"
+import "reflect"
+import "strconv"
+import "sync"
+import "unicode/utf8"
+
+//=============================================================================
+//
+// Codecs
+//
+//=============================================================================
+
+/*
+Translates keys or values of a single type to and from external
+representations, so trees holding them can be written out and read back
+*/
+type Codec interface {
+	/*
+		Return the name identifying the type in encoded output
+	*/
+	Tag() string
+	/*
+		Encode a key or value as text
+	*/
+	EncodeText(v interface{}) (string, error)
+	/*
+		Decode a key or value from text produced by EncodeText
+	*/
+	DecodeText(text string) (interface{}, error)
+	/*
+		Encode a key or value as compactly as possible
+	*/
+	EncodeBinary(v interface{}) ([]byte, error)
+	/*
+		Decode a key or value from data produced by EncodeBinary
+	*/
+	DecodeBinary(data []byte) (interface{}, error)
+}
+
+// guards the codec registry, as codecs may be registered while trees are
+// being written or read
+var codecsLock sync.RWMutex
+var codecsByTag = make(map[string]Codec)
+var codecsByType = make(map[reflect.Type]Codec)
+
+func init() {
+	RegisterCodec(IntKey(0), intKeyCodec{})
+	RegisterCodec(StringValue(""), stringValueCodec{})
+	RegisterCodec(BytesValue(nil), bytesValueCodec{})
+	RegisterCodec(IntValue(0), intValueCodec{})
+	RegisterCodec(FloatValue(0), floatValueCodec{})
+	RegisterCodec(ValueList(nil), valueListCodec{})
+}
+
+/*
+Register the codec to use for keys or values of the same type as sample;
+registering another codec with the same type or tag replaces the first
+*/
+func RegisterCodec(sample interface{}, codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecsByTag[codec.Tag()] = codec
+	codecsByType[reflect.TypeOf(sample)] = codec
+}
+
+func codecFor(v interface{}) (Codec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	codec, ok := codecsByType[reflect.TypeOf(v)]
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for %T", v)
+	}
+	return codec, nil
+}
+
+func codecForTag(tag string) (Codec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	codec, ok := codecsByTag[tag]
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for tag %q", tag)
+	}
+	return codec, nil
+}
+
+/*
+Return the tag and text encoding of a key or value
+*/
+func encodeTagged(v interface{}) (string, string, error) {
+	codec, err := codecFor(v)
+	if err != nil {
+		return "", "", err
+	}
+	text, err := codec.EncodeText(v)
+	return codec.Tag(), text, err
+}
+
+/*
+Return the tag and text encoding of a key or value to be written as a JSON
+string, which cannot hold text that is not valid UTF-8 without changing it
+*/
+func encodeTaggedJSON(v interface{}) (string, string, error) {
+	tag, text, err := encodeTagged(v)
+	if err == nil && !utf8.ValidString(text) {
+		err = fmt.Errorf("text encoding of %v %q is not valid UTF-8", tag, text)
+	}
+	return tag, text, err
+}
+
+func decodeTagged(tag, text string) (interface{}, error) {
+	codec, err := codecForTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	return codec.DecodeText(text)
+}
+
+func asEntry(k, v interface{}) (Key, Value, error) {
+	key, ok := k.(Key)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not a key", k)
+	}
+	value, err := asValue(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+func asValue(v interface{}) (Value, error) {
+	value, ok := v.(Value)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a value", v)
+	}
+	return value, nil
+}
+
+type intKeyCodec struct{}
+
+func (c intKeyCodec) Tag() string {
+	return "IntKey"
+}
+
+func (c intKeyCodec) EncodeText(v interface{}) (string, error) {
+	return strconv.Itoa(int(v.(IntKey))), nil
+}
+
+func (c intKeyCodec) DecodeText(text string) (interface{}, error) {
+	i, err := strconv.Atoi(text)
+	return IntKey(i), err
+}
+
+func (c intKeyCodec) EncodeBinary(v interface{}) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(v.(IntKey))), nil
+}
+
+func (c intKeyCodec) DecodeBinary(data []byte) (interface{}, error) {
+	i, err := decodeVarint(data)
+	return IntKey(i), err
+}
+
+type stringValueCodec struct{}
+
+func (c stringValueCodec) Tag() string {
+	return "StringValue"
+}
+
+func (c stringValueCodec) EncodeText(v interface{}) (string, error) {
+	return string(v.(StringValue)), nil
+}
+
+func (c stringValueCodec) DecodeText(text string) (interface{}, error) {
+	return StringValue(text), nil
+}
+
+func (c stringValueCodec) EncodeBinary(v interface{}) ([]byte, error) {
+	return []byte(v.(StringValue)), nil
+}
+
+func (c stringValueCodec) DecodeBinary(data []byte) (interface{}, error) {
+	return StringValue(data), nil
+}
+
+type bytesValueCodec struct{}
+
+func (c bytesValueCodec) Tag() string {
+	return "BytesValue"
+}
+
+func (c bytesValueCodec) EncodeText(v interface{}) (string, error) {
+	return hex.EncodeToString(v.(BytesValue)), nil
+}
+
+func (c bytesValueCodec) DecodeText(text string) (interface{}, error) {
+	b, err := hex.DecodeString(text)
+	return BytesValue(b), err
+}
+
+func (c bytesValueCodec) EncodeBinary(v interface{}) ([]byte, error) {
+	return []byte(v.(BytesValue)), nil
+}
+
+func (c bytesValueCodec) DecodeBinary(data []byte) (interface{}, error) {
+	return BytesValue(append([]byte{}, data...)), nil
+}
+
+type intValueCodec struct{}
+
+func (c intValueCodec) Tag() string {
+	return "IntValue"
+}
+
+func (c intValueCodec) EncodeText(v interface{}) (string, error) {
+	return strconv.Itoa(int(v.(IntValue))), nil
+}
+
+func (c intValueCodec) DecodeText(text string) (interface{}, error) {
+	i, err := strconv.Atoi(text)
+	return IntValue(i), err
+}
+
+func (c intValueCodec) EncodeBinary(v interface{}) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(v.(IntValue))), nil
+}
+
+func (c intValueCodec) DecodeBinary(data []byte) (interface{}, error) {
+	i, err := decodeVarint(data)
+	return IntValue(i), err
+}
+
+type floatValueCodec struct{}
+
+func (c floatValueCodec) Tag() string {
+	return "FloatValue"
+}
+
+func (c floatValueCodec) EncodeText(v interface{}) (string, error) {
+	return strconv.FormatFloat(float64(v.(FloatValue)), 'g', -1, 64), nil
+}
+
+func (c floatValueCodec) DecodeText(text string) (interface{}, error) {
+	f, err := strconv.ParseFloat(text, 64)
+	return FloatValue(f), err
+}
+
+func (c floatValueCodec) EncodeBinary(v interface{}) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(v.(FloatValue)))), nil
+}
+
+func (c floatValueCodec) DecodeBinary(data []byte) (interface{}, error) {
+	if len(data) != 8 {
+		return nil, errors.New("float value must be 8 bytes")
+	}
+	return FloatValue(math.Float64frombits(binary.BigEndian.Uint64(data))), nil
+}
+
+/*
+Value lists are encoded as text as a JSON array holding the tag and text of
+each value, and in binary like a tree, as a table of the tags of the codecs
+used followed by a uvarint count and each value as the index of its tag and
+its encoding
+*/
+type valueListCodec struct{}
+
+func (c valueListCodec) Tag() string {
+	return "ValueList"
+}
+
+func (c valueListCodec) EncodeText(v interface{}) (string, error) {
+	values := v.(ValueList)
+	entries := make([][2]string, len(values))
+	for i, value := range values {
+		var err error
+		if entries[i][0], entries[i][1], err = encodeTaggedJSON(value); err != nil {
+			return "", err
+		}
+	}
+	text, err := json.Marshal(entries)
+	return string(text), err
+}
+
+func (c valueListCodec) DecodeText(text string) (interface{}, error) {
+	var entries [][2]string
+	if err := json.Unmarshal([]byte(text), &entries); err != nil {
+		return nil, err
+	}
+	values := make(ValueList, len(entries))
+	for i, entry := range entries {
+		v, err := decodeTagged(entry[0], entry[1])
+		if err != nil {
+			return nil, err
+		}
+		if values[i], err = asValue(v); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (c valueListCodec) EncodeBinary(v interface{}) ([]byte, error) {
+	values := v.(ValueList)
+	tags := newTagTable()
+	encoded := make([]byte, 0)
+	for _, value := range values {
+		var err error
+		if encoded, err = tags.appendIndexed(encoded, value); err != nil {
+			return nil, err
+		}
+	}
+	data := binary.AppendUvarint(tags.appendTable(nil), uint64(len(values)))
+	return append(data, encoded...), nil
+}
+
+func (c valueListCodec) DecodeBinary(data []byte) (interface{}, error) {
+	codecs, data, err := readTagTable(data)
+	if err != nil {
+		return nil, err
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, errors.New("malformed value count")
+	}
+	data = data[n:]
+	values := make(ValueList, 0)
+	for i := uint64(0); i < count; i++ {
+		var v interface{}
+		if v, data, err = codecs.readIndexed(data); err != nil {
+			return nil, err
+		}
+		value, err := asValue(v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if len(data) > 0 {
+		return nil, fmt.Errorf("%v unexpected bytes after last value", len(data))
+	}
+	return values, nil
+}
+
+func decodeVarint(data []byte) (int64, error) {
+	i, n := binary.Varint(data)
+	if n <= 0 || n != len(data) {
+		return 0, errors.New("malformed varint")
+	}
+	return i, nil
+}
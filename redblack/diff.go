@@ -0,0 +1,202 @@
+package redblack
+
+import "reflect"
+
+//=============================================================================
+//
+// Diffs
+//
+//=============================================================================
+
+/*
+The kinds of difference between two trees reported by Diff
+*/
+type ChangeKind int
+
+const (
+	/*
+		The key is only in the second tree
+	*/
+	Added ChangeKind = iota
+	/*
+		The key is only in the first tree
+	*/
+	Removed
+	/*
+		The key is in both trees, with different values
+	*/
+	Changed
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return "unknown"
+}
+
+/*
+A single difference between two trees; Old is nil for added keys, and New is
+nil for removed keys
+*/
+type Change struct {
+	Kind     ChangeKind
+	Key      Key
+	Old, New Value
+}
+
+/*
+Return the changes that turn tree a into tree b, in key order
+*/
+func Diff(a, b LLRB) []Change {
+	changes := make([]Change, 0)
+	DiffNodes(a.Root(), b.Root(), func(change Change) bool {
+		changes = append(changes, change)
+		return true
+	})
+	return changes
+}
+
+/*
+Call visit, in key order, with each change that turns the tree rooted at a
+into the tree rooted at b, stopping early if visit returns false.  Subtrees
+that a and b share, such as those of a tree and its clone that neither has
+changed, are skipped without being visited, so diffing two versions of a tree
+takes time in proportion to how much they differ.
+*/
+func DiffNodes(a, b Node, visit func(change Change) bool) {
+	as, bs := newDiffStack(a), newDiffStack(b)
+	for !as.empty() && !bs.empty() {
+		ta, tb := as.top(), bs.top()
+		switch {
+		case !ta.expanded && !tb.expanded && ta.node == tb.node:
+			as.pop()
+			bs.pop()
+		case !ta.expanded && (tb.expanded || ta.above(tb)):
+			as.expand()
+		case !tb.expanded:
+			bs.expand()
+		default:
+			ka, kb := ta.node.Key(), tb.node.Key()
+			cmp := ka.Compare(kb)
+			var change *Change
+			if cmp < 0 {
+				change = &Change{Removed, ka, ta.node.Value(), nil}
+				as.pop()
+			} else if cmp > 0 {
+				change = &Change{Added, kb, nil, tb.node.Value()}
+				bs.pop()
+			} else {
+				if !reflect.DeepEqual(ta.node.Value(), tb.node.Value()) {
+					change = &Change{Changed, ka, ta.node.Value(), tb.node.Value()}
+				}
+				as.pop()
+				bs.pop()
+			}
+			if change != nil && !visit(*change) {
+				return
+			}
+		}
+	}
+	if !as.drain(Removed, visit) {
+		return
+	}
+	bs.drain(Added, visit)
+}
+
+/*
+A position in an in-order traversal, held as a stack of pending entries:
+either whole subtrees still to be visited, or (once expanded) single nodes
+whose left subtrees have already been visited.  Each subtree's black height
+is carried along with it, so subtrees at the same level of two trees can be
+lined up without measuring them.
+*/
+type diffStack []diffEntry
+
+type diffEntry struct {
+	node     Node
+	rank     int
+	expanded bool
+}
+
+func newDiffStack(h Node) *diffStack {
+	s := make(diffStack, 0)
+	s.push(h, blackHeight(h))
+	return &s
+}
+
+func (s *diffStack) empty() bool {
+	return len(*s) == 0
+}
+
+func (s *diffStack) top() diffEntry {
+	return (*s)[len(*s)-1]
+}
+
+func (s *diffStack) pop() {
+	*s = (*s)[:len(*s)-1]
+}
+
+func (s *diffStack) push(h Node, rank int) {
+	if h != nil {
+		*s = append(*s, diffEntry{h, rank, false})
+	}
+}
+
+/*
+Replace the subtree on top of the stack with its left subtree, its root, and
+its right subtree
+*/
+func (s *diffStack) expand() {
+	e := s.top()
+	s.pop()
+	rank := e.rank
+	if !isRed(e.node) {
+		rank--
+	}
+	s.push(e.node.Right(), rank)
+	*s = append(*s, diffEntry{e.node, e.rank, true})
+	s.push(e.node.Left(), rank)
+}
+
+/*
+Report every remaining key on the stack as a change of the given kind,
+returning false if visit asked to stop
+*/
+func (s *diffStack) drain(kind ChangeKind, visit func(change Change) bool) bool {
+	for !s.empty() {
+		if e := s.top(); !e.expanded {
+			s.expand()
+			continue
+		}
+		h := s.top().node
+		s.pop()
+		change := Change{Kind: kind, Key: h.Key()}
+		if kind == Removed {
+			change.Old = h.Value()
+		} else {
+			change.New = h.Value()
+		}
+		if !visit(change) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Return true if the subtree of e should be expanded before that of other:
+because it is taller, or because it is a red node above a black node of the
+same height
+*/
+func (e diffEntry) above(other diffEntry) bool {
+	if e.rank != other.rank {
+		return e.rank > other.rank
+	}
+	return isRed(e.node) || !isRed(other.node)
+}
@@ -0,0 +1,145 @@
+package redblack
+
+import "fmt"
+import "math/rand"
+import "sort"
+import "testing"
+
+func TestDiff(t *testing.T) {
+	a, b := NewLLRB(), NewLLRB()
+	for i := 1; i <= 10; i++ {
+		a.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		b.Insert(IntKey(i+2), StringValue(IntKey(i+2).String()))
+	}
+	b.Insert(IntKey(5), StringValue("five"))
+	b.Delete(IntKey(7))
+	changes := Diff(a, b)
+	expected := "[{removed 1 1 <nil>} {removed 2 2 <nil>} {changed 5 5 five} {removed 7 7 <nil>} " +
+		"{added 11 <nil> 11} {added 12 <nil> 12}]"
+	if fmt.Sprint(changes) != expected {
+		log.Error("Expected changes %v, saw %v", expected, changes)
+		t.Fail()
+	}
+	if changes := Diff(a, a); len(changes) != 0 {
+		log.Error("Expected no changes between a tree and itself, saw %v", changes)
+		t.Fail()
+	}
+	if changes := Diff(NewLLRB(), NewLLRB()); len(changes) != 0 {
+		log.Error("Expected no changes between empty trees, saw %v", changes)
+		t.Fail()
+	}
+	count := 0
+	DiffNodes(a.Root(), b.Root(), func(change Change) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		log.Error("Expected diff to stop after 3 changes, saw %v", count)
+		t.Fail()
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(43))
+	for round := 0; round < 50; round++ {
+		a := NewLLRB()
+		for i := 0; i < random.Intn(200); i++ {
+			k := random.Intn(100)
+			a.Insert(IntKey(k), StringValue(IntKey(k).String()))
+		}
+		// half the time, diff against a clone so that subtrees are shared
+		var b LLRB
+		if round%2 == 0 {
+			b = a.Clone()
+		} else {
+			b = NewLLRB()
+			walk(a.Root(), func(h Node) {
+				b.Insert(h.Key(), h.Value())
+			})
+		}
+		for i := 0; i < random.Intn(20); i++ {
+			k := random.Intn(120)
+			if random.Intn(2) == 0 {
+				b.Delete(IntKey(k))
+			} else {
+				b.Insert(IntKey(k), StringValue(fmt.Sprintf("%v@%v", k, i)))
+			}
+		}
+		expected := fmt.Sprint(naiveDiff(a, b))
+		if changes := fmt.Sprint(Diff(a, b)); changes != expected {
+			log.Error("Round %v: expected changes %v, saw %v", round, expected, changes)
+			t.Fail()
+		}
+	}
+}
+
+func TestDiffShared(t *testing.T) {
+	a := NewLLRB()
+	for i := 0; i < 10000; i++ {
+		a.Insert(countingKey(i), StringValue(IntKey(i).String()))
+	}
+	b := a.Clone()
+	b.Insert(countingKey(5000), StringValue("changed"))
+	b.Delete(countingKey(7))
+	comparisons = 0
+	changes := Diff(a, b)
+	if fmt.Sprint(changes) != "[{removed 7 7 <nil>} {changed 5000 5000 changed}]" {
+		log.Error("Expected key 7 removed and 5000 changed, saw %v", changes)
+		t.Fail()
+	}
+	// only the paths to the changed keys should have been compared
+	if comparisons > 100 {
+		log.Error("Expected shared subtrees to be skipped, but saw %v comparisons", comparisons)
+		t.Fail()
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+var comparisons int
+
+/*
+Key that counts how many times keys are compared
+*/
+type countingKey int
+
+func (key countingKey) Compare(other Key) int {
+	comparisons++
+	return IntKey(key).Compare(IntKey(other.(countingKey)))
+}
+
+func (key countingKey) String() string {
+	return IntKey(key).String()
+}
+
+func naiveDiff(a, b LLRB) []Change {
+	values := func(tree LLRB) map[IntKey]Value {
+		m := make(map[IntKey]Value)
+		walk(tree.Root(), func(h Node) {
+			m[h.Key().(IntKey)] = h.Value()
+		})
+		return m
+	}
+	va, vb := values(a), values(b)
+	changes := make([]Change, 0)
+	for k, v := range va {
+		if w, ok := vb[k]; !ok {
+			changes = append(changes, Change{Removed, k, v, nil})
+		} else if v != w {
+			changes = append(changes, Change{Changed, k, v, w})
+		}
+	}
+	for k, w := range vb {
+		if _, ok := va[k]; !ok {
+			changes = append(changes, Change{Added, k, nil, w})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key.Compare(changes[j].Key) < 0
+	})
+	return changes
+}
@@ -0,0 +1,54 @@
+package redblack
+
+import "bufio"
+import "fmt"
+import "io"
+import "strconv"
+
+//=============================================================================
+//
+// Graphviz output
+//
+//=============================================================================
+
+/*
+Write the structure of the tree to w as a Graphviz (http://www.graphviz.org)
+digraph, with each node labelled by its key and filled with its color, and
+with links to red nodes drawn in red.  If nilLeaves is true, the nil leaves
+below each node are drawn as well, as small black points.
+*/
+func WriteDOT(w io.Writer, tree LLRB, nilLeaves bool) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph redblack {")
+	fmt.Fprintln(out, "\tnode [style=filled, fontcolor=white];")
+	ids := 0
+	var visit func(h Node) string
+	visit = func(h Node) string {
+		id := fmt.Sprintf("n%v", ids)
+		ids++
+		if h == nil {
+			fmt.Fprintf(out, "\t%v [shape=point, color=black];\n", id)
+			return id
+		}
+		fmt.Fprintf(out, "\t%v [label=%v, fillcolor=%v];\n", id, strconv.Quote(h.Key().String()), colorName(h))
+		for _, child := range []Node{h.Left(), h.Right()} {
+			if child != nil || nilLeaves {
+				childId := visit(child)
+				fmt.Fprintf(out, "\t%v -> %v [color=%v];\n", id, childId, colorName(child))
+			}
+		}
+		return id
+	}
+	if tree.Root() != nil || nilLeaves {
+		visit(tree.Root())
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+func colorName(h Node) string {
+	if isRed(h) {
+		return "red"
+	}
+	return "black"
+}
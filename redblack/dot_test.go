@@ -0,0 +1,53 @@
+package redblack
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestWriteDOT(t *testing.T) {
+	tree := NewLLRB()
+	tree.Insert(IntKey(2), StringValue("two"))
+	tree.Insert(IntKey(1), StringValue("one"))
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, tree, false); err != nil {
+		log.Error("Failed writing DOT: %v", err)
+		t.FailNow()
+	}
+	expected := `digraph redblack {
+	node [style=filled, fontcolor=white];
+	n0 [label="2", fillcolor=black];
+	n1 [label="1", fillcolor=red];
+	n0 -> n1 [color=red];
+}
+`
+	if buf.String() != expected {
+		log.Error("Expected DOT:\n%v\nsaw:\n%v", expected, buf.String())
+		t.Fail()
+	}
+}
+
+func TestWriteDOTNilLeaves(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 20; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, tree, true); err != nil {
+		log.Error("Failed writing DOT: %v", err)
+		t.FailNow()
+	}
+	// a tree of n nodes has n+1 nil leaves, and 2n links to draw
+	if leaves := strings.Count(buf.String(), "shape=point"); leaves != 21 {
+		log.Error("Expected 21 nil leaves, saw %v", leaves)
+		t.Fail()
+	}
+	if links := strings.Count(buf.String(), "->"); links != 40 {
+		log.Error("Expected 40 links, saw %v", links)
+		t.Fail()
+	}
+	buf.Reset()
+	if err := WriteDOT(&buf, NewLLRB(), false); err != nil || strings.Contains(buf.String(), "n0") {
+		log.Error("Expected no nodes for empty tree, saw %v", buf.String())
+		t.Fail()
+	}
+}
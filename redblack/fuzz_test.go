@@ -0,0 +1,89 @@
+package redblack
+
+import "testing"
+
+const (
+	fuzzInsert = iota
+	fuzzDelete
+	fuzzSearch
+	fuzzOperations
+)
+
+/*
+Each pair of bytes in the input is one operation: the first byte picks
+insert, delete or search, and the second is the key
+*/
+func FuzzOperations(f *testing.F) {
+	ascending := func(op byte, from, to int) []byte {
+		ops := make([]byte, 0)
+		for k := from; k <= to; k++ {
+			ops = append(ops, op, byte(k))
+		}
+		return ops
+	}
+	descending := func(op byte, from, to int) []byte {
+		ops := make([]byte, 0)
+		for k := from; k >= to; k-- {
+			ops = append(ops, op, byte(k))
+		}
+		return ops
+	}
+	concat := func(parts ...[]byte) []byte {
+		ops := make([]byte, 0)
+		for _, part := range parts {
+			ops = append(ops, part...)
+		}
+		return ops
+	}
+	f.Add([]byte{})
+	f.Add(concat(ascending(fuzzInsert, 1, 3), ascending(fuzzDelete, 1, 3)))
+	f.Add(concat(ascending(fuzzInsert, 1, 50), ascending(fuzzDelete, 1, 50)))
+	f.Add(concat(ascending(fuzzInsert, 1, 50), descending(fuzzDelete, 50, 1)))
+	// inserting in order leaves 4-nodes (nodes with 2 red children) along
+	// the right edge of the tree; deleting through them exercises the
+	// deviation from the paper in delete, and fixUp's handling of 4-nodes
+	f.Add(concat(ascending(fuzzInsert, 1, 7), []byte{fuzzDelete, 6, fuzzDelete, 7, fuzzDelete, 5}))
+	f.Add(concat(ascending(fuzzInsert, 1, 15), []byte{fuzzDelete, 14, fuzzDelete, 12, fuzzDelete, 8}))
+	f.Add(concat(ascending(fuzzInsert, 1, 31), []byte{fuzzDelete, 16, fuzzDelete, 24, fuzzDelete, 30}))
+	f.Add(concat(descending(fuzzInsert, 31, 1), ascending(fuzzDelete, 10, 20), ascending(fuzzSearch, 1, 31)))
+	// sequences which left right-leaning red links behind before fixUp
+	// handled 4-nodes, including a delete of a key not in the tree
+	f.Add([]byte{fuzzInsert, 48, fuzzInsert, 2, fuzzInsert, 3, fuzzInsert, 4, fuzzInsert, 5, fuzzInsert, 55, fuzzInsert, 49, fuzzDelete, 50})
+	f.Add([]byte{
+		fuzzInsert, 68, fuzzInsert, 12, fuzzInsert, 49, fuzzInsert, 15, fuzzInsert, 13, fuzzInsert, 2,
+		fuzzInsert, 29, fuzzInsert, 56, fuzzInsert, 96, fuzzInsert, 50, fuzzInsert, 10, fuzzInsert, 84,
+		fuzzInsert, 43, fuzzInsert, 25, fuzzInsert, 46, fuzzInsert, 60, fuzzInsert, 85, fuzzInsert, 5,
+		fuzzInsert, 28, fuzzInsert, 28, fuzzDelete, 49, fuzzInsert, 62, fuzzInsert, 98, fuzzDelete, 60,
+	})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tree := NewLLRB()
+		expected := make(map[IntKey]Value)
+		for i := 0; i+1 < len(data); i += 2 {
+			key := IntKey(data[i+1])
+			switch data[i] % fuzzOperations {
+			case fuzzInsert:
+				value := StringValue(IntKey(i).String())
+				tree.Insert(key, value)
+				expected[key] = value
+			case fuzzDelete:
+				tree.Delete(key)
+				delete(expected, key)
+			case fuzzSearch:
+				if found := tree.Search(key); found != expected[key] {
+					t.Fatalf("operation %v: expected %v for key %v, found %v", i/2, expected[key], key, found)
+				}
+			}
+			if err := Verify(tree); err != nil {
+				t.Fatalf("operation %v: %v\n%v", i/2, err, tree)
+			}
+			if tree.Size() != len(expected) {
+				t.Fatalf("operation %v: expected %v keys, tree has %v", i/2, len(expected), tree.Size())
+			}
+		}
+		for key, value := range expected {
+			if found := tree.Search(key); found != value {
+				t.Fatalf("expected %v for key %v, found %v", value, key, found)
+			}
+		}
+	})
+}
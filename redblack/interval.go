@@ -0,0 +1,120 @@
+package redblack
+
+import "fmt"
+
+//=============================================================================
+//
+// Interval trees
+//
+//=============================================================================
+
+/*
+A red-black tree keyed by closed intervals, able to answer which of its
+intervals overlap a given point or interval
+*/
+type IntervalTree interface {
+	LLRB
+	/*
+		Return the nodes whose intervals overlap the closed interval from
+		low to high, in key order
+	*/
+	Overlapping(low, high Key) []Node
+	/*
+		Return the nodes whose intervals contain the point, in key order
+	*/
+	Stabbing(point Key) []Node
+}
+
+/*
+A closed interval between 2 keys, usable as a key in an interval tree;
+intervals are ordered by their low endpoint, then by their high endpoint
+*/
+type Interval struct {
+	Low, High Key
+}
+
+func (i Interval) Compare(other Key) int {
+	o := other.(Interval)
+	if cmp := i.Low.Compare(o.Low); cmp != 0 {
+		return cmp
+	}
+	return i.High.Compare(o.High)
+}
+
+func (i Interval) String() string {
+	return fmt.Sprintf("[%v,%v]", i.Low, i.High)
+}
+
+/*
+Return true if the interval shares at least one point with the closed
+interval from low to high
+*/
+func (i Interval) Overlaps(low, high Key) bool {
+	return i.Low.Compare(high) <= 0 && low.Compare(i.High) <= 0
+}
+
+/*
+Intervals are summarized by the largest high endpoint in each subtree, which
+lets queries skip any subtree that ends before the range of interest
+*/
+type maxEndpointMonoid struct{}
+
+type intervalTree struct {
+	AugmentedLLRB
+}
+
+/*
+Create a new, empty interval tree; all keys inserted must be Intervals
+*/
+func NewIntervalTree() IntervalTree {
+	return &intervalTree{NewAugmentedLLRB(maxEndpointMonoid{})}
+}
+
+func (tree *intervalTree) Clone() LLRB {
+	return &intervalTree{tree.AugmentedLLRB.Clone().(AugmentedLLRB)}
+}
+
+func (tree *intervalTree) Overlapping(low, high Key) []Node {
+	found := make([]Node, 0)
+	var visit func(h Node)
+	visit = func(h Node) {
+		if h == nil || maxEndpoint(h).Compare(low) < 0 {
+			return
+		}
+		visit(h.Left())
+		interval := h.Key().(Interval)
+		if interval.Low.Compare(high) > 0 {
+			// every interval to the right starts even later
+			return
+		}
+		if interval.Overlaps(low, high) {
+			found = append(found, h)
+		}
+		visit(h.Right())
+	}
+	visit(tree.Root())
+	return found
+}
+
+func (tree *intervalTree) Stabbing(point Key) []Node {
+	return tree.Overlapping(point, point)
+}
+
+func (m maxEndpointMonoid) Identity() interface{} {
+	return nil
+}
+
+func (m maxEndpointMonoid) Combine(a, b interface{}) interface{} {
+	if a == nil || (b != nil && b.(Key).Compare(a.(Key)) > 0) {
+		return b
+	}
+	return a
+}
+
+func (m maxEndpointMonoid) Measure(key Key, value Value) interface{} {
+	return key.(Interval).High
+}
+
+func maxEndpoint(h Node) Key {
+	return aggregate(h, maxEndpointMonoid{}).(Key)
+}
@@ -0,0 +1,126 @@
+package redblack
+
+import "math/rand"
+import "testing"
+
+func TestIntervalQueries(t *testing.T) {
+	tree, intervals := genIntervalTree(200)
+	allOk := checkIntervalQueries(tree, intervals)
+	// remove every third interval to shuffle the tree around
+	remaining := make([]Interval, 0)
+	for i, interval := range intervals {
+		if i%3 == 0 {
+			tree.Delete(interval)
+		} else {
+			remaining = append(remaining, interval)
+		}
+	}
+	allOk = checkIntervalQueries(tree, remaining) && allOk
+	if !allOk {
+		t.Fail()
+	}
+}
+
+func TestIntervalMaxEndpoints(t *testing.T) {
+	tree, intervals := genIntervalTree(200)
+	allOk := checkMaxEndpoints(tree.Root())
+	for i := 0; i < len(intervals); i += 2 {
+		tree.Delete(intervals[i])
+		allOk = checkMaxEndpoints(tree.Root()) && allOk
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
+
+func TestEmptyIntervalTree(t *testing.T) {
+	tree := NewIntervalTree()
+	if found := tree.Stabbing(IntKey(1)); len(found) != 0 {
+		log.Error("Empty interval tree found intervals: %v", found)
+		t.Fail()
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+func genIntervalTree(count int) (IntervalTree, []Interval) {
+	random := rand.New(rand.NewSource(1))
+	tree := NewIntervalTree()
+	intervals := make([]Interval, 0, count)
+	seen := make(map[Interval]bool)
+	for len(intervals) < count {
+		low := random.Intn(1000)
+		interval := Interval{IntKey(low), IntKey(low + random.Intn(100))}
+		if !seen[interval] {
+			seen[interval] = true
+			intervals = append(intervals, interval)
+			tree.Insert(interval, StringValue(interval.String()))
+		}
+	}
+	return tree, intervals
+}
+
+func checkIntervalQueries(tree IntervalTree, intervals []Interval) bool {
+	allOk := true
+	for low := -10; low < 1110; low += 7 {
+		high := low + low%13
+		expected := 0
+		for _, interval := range intervals {
+			if interval.Overlaps(IntKey(low), IntKey(high)) {
+				expected++
+			}
+		}
+		found := tree.Overlapping(IntKey(low), IntKey(high))
+		if len(found) != expected {
+			log.Error("Expected %v intervals overlapping [%v,%v], found %v", expected, low, high, len(found))
+			allOk = false
+		}
+		for i, h := range found {
+			if !h.Key().(Interval).Overlaps(IntKey(low), IntKey(high)) {
+				log.Error("Interval %v does not overlap [%v,%v]", h.Key(), low, high)
+				allOk = false
+			}
+			if i > 0 && found[i-1].Key().Compare(h.Key()) >= 0 {
+				log.Error("Intervals found out of order: %v before %v", found[i-1].Key(), h.Key())
+				allOk = false
+			}
+		}
+		stabbed := 0
+		for _, interval := range intervals {
+			if interval.Overlaps(IntKey(low), IntKey(low)) {
+				stabbed++
+			}
+		}
+		if found := tree.Stabbing(IntKey(low)); len(found) != stabbed {
+			log.Error("Expected %v intervals containing %v, found %v", stabbed, low, len(found))
+			allOk = false
+		}
+	}
+	return allOk
+}
+
+func checkMaxEndpoints(h Node) bool {
+	allOk := true
+	visitNodes(h, func(h Node) {
+		if h == nil {
+			return
+		}
+		var max Key
+		visitNodes(h, func(n Node) {
+			if n != nil {
+				if high := n.Key().(Interval).High; max == nil || high.Compare(max) > 0 {
+					max = high
+				}
+			}
+		})
+		if maxEndpoint(h) != max {
+			log.Error("Node %v has max endpoint %v, expected %v", h.Key(), maxEndpoint(h), max)
+			allOk = false
+		}
+	})
+	return allOk
+}
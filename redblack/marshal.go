@@ -0,0 +1,288 @@
+package redblack
+
+import "encoding/binary"
+import "encoding/json"
+import "errors"
+import "fmt"
+
+//=============================================================================
+//
+// JSON and binary encodings
+//
+//=============================================================================
+
+/*
+Each key and value in JSON is held as the tag of its codec and its text
+*/
+type jsonEntry struct {
+	KeyType   string `json:"keyType"`
+	Key       string `json:"key"`
+	ValueType string `json:"valueType"`
+	Value     string `json:"value"`
+}
+
+func (tree *llrb) MarshalJSON() ([]byte, error) {
+	entries := make([]jsonEntry, 0)
+	var err error
+	walk(tree.Root(), func(h Node) {
+		if err != nil {
+			return
+		}
+		var entry jsonEntry
+		if entry.KeyType, entry.Key, err = encodeTaggedJSON(h.Key()); err != nil {
+			return
+		}
+		entry.ValueType, entry.Value, err = encodeTaggedJSON(h.Value())
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entries)
+}
+
+func (tree *llrb) UnmarshalJSON(data []byte) error {
+	var entries []jsonEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	keys := make([]Key, len(entries))
+	values := make([]Value, len(entries))
+	for i, entry := range entries {
+		k, err := decodeTagged(entry.KeyType, entry.Key)
+		if err != nil {
+			return err
+		}
+		v, err := decodeTagged(entry.ValueType, entry.Value)
+		if err != nil {
+			return err
+		}
+		if keys[i], values[i], err = asEntry(k, v); err != nil {
+			return err
+		}
+	}
+	tree.replace(keys, values)
+	return nil
+}
+
+/*
+The binary encoding is a table of the tags of the codecs used, followed by
+the number of entries and each key and value as the index of its codec's tag
+in the table and its binary encoding.  The number of tags, each tag, and the
+count, indexes and encodings are all written as uvarints or prefixed by
+their length as a uvarint, so an entry whose key and value are each encoded
+in under 128 bytes costs 4 bytes more than the encodings themselves.
+*/
+func (tree *llrb) MarshalBinary() ([]byte, error) {
+	tags := newTagTable()
+	entries := make([]byte, 0)
+	count := 0
+	var err error
+	walk(tree.Root(), func(h Node) {
+		if err != nil {
+			return
+		}
+		if entries, err = tags.appendIndexed(entries, h.Key()); err != nil {
+			return
+		}
+		entries, err = tags.appendIndexed(entries, h.Value())
+		count++
+	})
+	if err != nil {
+		return nil, err
+	}
+	data := binary.AppendUvarint(tags.appendTable(nil), uint64(count))
+	return append(data, entries...), nil
+}
+
+func (tree *llrb) UnmarshalBinary(data []byte) error {
+	codecs, data, err := readTagTable(data)
+	if err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errors.New("malformed entry count")
+	}
+	data = data[n:]
+	keys := make([]Key, 0)
+	values := make([]Value, 0)
+	for i := uint64(0); i < count; i++ {
+		var k, v interface{}
+		if k, data, err = codecs.readIndexed(data); err != nil {
+			return err
+		}
+		if v, data, err = codecs.readIndexed(data); err != nil {
+			return err
+		}
+		key, value, err := asEntry(k, v)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%v unexpected bytes after last entry", len(data))
+	}
+	tree.replace(keys, values)
+	return nil
+}
+
+/*
+Replace the contents of the tree with the provided keys and values
+*/
+func (tree *llrb) replace(keys []Key, values []Value) {
+	tree.SetRoot(nil)
+	for i, key := range keys {
+		tree.Insert(key, values[i])
+	}
+}
+
+/*
+The tags of the codecs used by an encoding holding many keys or values, so
+each tag is written once and each key or value refers to it by index
+*/
+type tagTable struct {
+	tags    []string
+	indexes map[string]int
+}
+
+func newTagTable() *tagTable {
+	return &tagTable{make([]string, 0), make(map[string]int)}
+}
+
+/*
+Append the index of the tag of a key or value, adding it to the table if it
+is not there already, and its binary encoding to data
+*/
+func (table *tagTable) appendIndexed(data []byte, v interface{}) ([]byte, error) {
+	codec, err := codecFor(v)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := codec.EncodeBinary(v)
+	if err != nil {
+		return nil, err
+	}
+	index, ok := table.indexes[codec.Tag()]
+	if !ok {
+		index = len(table.tags)
+		table.indexes[codec.Tag()] = index
+		table.tags = append(table.tags, codec.Tag())
+	}
+	return appendBytes(binary.AppendUvarint(data, uint64(index)), encoded), nil
+}
+
+/*
+Append the number of tags and each tag to data
+*/
+func (table *tagTable) appendTable(data []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(table.tags)))
+	for _, tag := range table.tags {
+		data = appendBytes(data, []byte(tag))
+	}
+	return data
+}
+
+/*
+The codecs for the tags in a table written by appendTable, in order
+*/
+type tagCodecs []Codec
+
+/*
+Read a table written by appendTable from the start of data, returning the
+codecs for its tags and the remaining data
+*/
+func readTagTable(data []byte) (tagCodecs, []byte, error) {
+	tagCount, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, errors.New("malformed tag count")
+	}
+	data = data[n:]
+	codecs := make(tagCodecs, 0)
+	for i := uint64(0); i < tagCount; i++ {
+		var tag []byte
+		var err error
+		if tag, data, err = readBytes(data); err != nil {
+			return nil, nil, err
+		}
+		codec, err := codecForTag(string(tag))
+		if err != nil {
+			return nil, nil, err
+		}
+		codecs = append(codecs, codec)
+	}
+	return codecs, data, nil
+}
+
+/*
+Read a key or value written by appendIndexed from the start of data,
+returning it and the remaining data
+*/
+func (codecs tagCodecs) readIndexed(data []byte) (interface{}, []byte, error) {
+	index, n := binary.Uvarint(data)
+	if n <= 0 || index >= uint64(len(codecs)) {
+		return nil, nil, errors.New("malformed tag index")
+	}
+	encoded, data, err := readBytes(data[n:])
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := codecs[index].DecodeBinary(encoded)
+	return v, data, err
+}
+
+/*
+Append the tag and binary encoding of a key or value to data.  Log records,
+Merkle hashes and sync messages each hold only a key or two and a value, and
+must be read on their own, so they write tags in full rather than sharing a
+table.
+*/
+func appendBinary(data []byte, v interface{}) ([]byte, error) {
+	codec, err := codecFor(v)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := codec.EncodeBinary(v)
+	if err != nil {
+		return nil, err
+	}
+	data = appendBytes(data, []byte(codec.Tag()))
+	return appendBytes(data, encoded), nil
+}
+
+/*
+Read a key or value written by appendBinary from the start of data, returning
+it and the remaining data
+*/
+func readBinary(data []byte) (interface{}, []byte, error) {
+	tag, data, err := readBytes(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	codec, err := codecForTag(string(tag))
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, data, err := readBytes(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := codec.DecodeBinary(encoded)
+	return v, data, err
+}
+
+func appendBytes(data, b []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(b)))
+	return append(data, b...)
+}
+
+func readBytes(data []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil, errors.New("truncated data")
+	}
+	data = data[n:]
+	return data[:length], data[length:], nil
+}
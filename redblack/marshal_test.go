@@ -0,0 +1,184 @@
+package redblack
+
+import "bytes"
+import "encoding/json"
+import "sync"
+import "testing"
+
+func TestJSONRoundTrip(t *testing.T) {
+	tree := genMixedTree()
+	data, err := json.Marshal(tree)
+	if err != nil {
+		log.Error("Failed marshaling JSON: %v", err)
+		t.FailNow()
+	}
+	expected := `[{"keyType":"IntKey","key":"-7","valueType":"BytesValue","value":"00ff0a"},` +
+		`{"keyType":"IntKey","key":"1","valueType":"StringValue","value":"one"},` +
+		`{"keyType":"IntKey","key":"300","valueType":"StringValue","value":"with \"quotes\"\n"},` +
+		`{"keyType":"IntKey","key":"1000000","valueType":"BytesValue","value":""}]`
+	if string(data) != expected {
+		log.Error("Expected JSON %v, saw %v", expected, string(data))
+		t.Fail()
+	}
+	copied := NewLLRB()
+	copied.Insert(IntKey(5), StringValue("replaced"))
+	if err := json.Unmarshal(data, copied); err != nil {
+		log.Error("Failed unmarshaling JSON: %v", err)
+		t.FailNow()
+	}
+	if !checkSameContents(tree, copied) || !checkInvariants(copied) {
+		t.Fail()
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tree := genMixedTree()
+	for i := 0; i < 100; i++ {
+		tree.Insert(IntKey(i*i), StringValue(IntKey(i).String()))
+	}
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		log.Error("Failed marshaling binary: %v", err)
+		t.FailNow()
+	}
+	copied := NewLLRB()
+	copied.Insert(IntKey(5), StringValue("replaced"))
+	if err := copied.UnmarshalBinary(data); err != nil {
+		log.Error("Failed unmarshaling binary: %v", err)
+		t.FailNow()
+	}
+	if !checkSameContents(tree, copied) || !checkInvariants(copied) {
+		t.Fail()
+	}
+	for _, n := range []int{0, 1, len(data) / 2, len(data) - 1} {
+		if err := NewLLRB().UnmarshalBinary(data[:n]); err == nil {
+			log.Error("Expected error unmarshaling %v of %v bytes", n, len(data))
+			t.Fail()
+		}
+	}
+	if err := NewLLRB().UnmarshalBinary(append(data, 0)); err == nil {
+		log.Error("Expected error unmarshaling with trailing data")
+		t.Fail()
+	}
+}
+
+func TestBinarySize(t *testing.T) {
+	tree := NewLLRB()
+	payload := 0
+	for i := 0; i < 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		codec, _ := codecFor(IntKey(i))
+		key, _ := codec.EncodeBinary(IntKey(i))
+		payload += len(key) + len(IntKey(i).String())
+	}
+	data, _ := tree.MarshalBinary()
+	// tags are written once, then each entry adds an index and a length
+	// to each of its key and value
+	header := len("IntKey") + len("StringValue") + 4
+	if len(data) > payload+4*100+header {
+		log.Error("Expected at most %v bytes, saw %v", payload+4*100+header, len(data))
+		t.Fail()
+	}
+}
+
+func TestEmptyTreeRoundTrip(t *testing.T) {
+	data, err := NewLLRB().MarshalBinary()
+	if err != nil || len(data) != 2 {
+		log.Error("Expected two byte encoding of empty tree, saw %v (%v)", data, err)
+		t.Fail()
+	}
+	if data, err := json.Marshal(NewLLRB()); err != nil || string(data) != "[]" {
+		log.Error("Expected empty JSON array for empty tree, saw %v (%v)", string(data), err)
+		t.Fail()
+	}
+}
+
+func TestInvalidUTF8RoundTrip(t *testing.T) {
+	invalid := StringValue([]byte{'a', 0xff, 0xfe, 'b'})
+	for _, value := range []Value{invalid, ValueList{StringValue("ok"), invalid}} {
+		tree := NewLLRB()
+		tree.Insert(IntKey(1), value)
+		if _, err := json.Marshal(tree); err == nil {
+			log.Error("Expected error marshaling invalid UTF-8 as JSON in %v", value)
+			t.Fail()
+		}
+		data, err := tree.MarshalBinary()
+		copied := NewLLRB()
+		if err == nil {
+			err = copied.UnmarshalBinary(data)
+		}
+		if err != nil || !checkSameContents(tree, copied) {
+			log.Error("Expected invalid UTF-8 to round trip in binary: %v", err)
+			t.Fail()
+		}
+		var buf bytes.Buffer
+		if _, ok := value.(ValueList); ok {
+			// lists are written as text in JSON, so are rejected too
+			if err := WriteText(&buf, tree); err == nil {
+				log.Error("Expected error writing invalid UTF-8 in a list as text")
+				t.Fail()
+			}
+			continue
+		}
+		if err := WriteText(&buf, tree); err != nil {
+			log.Error("Failed writing text: %v", err)
+			t.FailNow()
+		}
+		copied, err = ReadText(&buf, NewMemoryLLRBImpl())
+		if err != nil || !checkSameContents(tree, copied) {
+			log.Error("Expected invalid UTF-8 to round trip in text: %v", err)
+			t.Fail()
+		}
+	}
+}
+
+func TestValueListTagTable(t *testing.T) {
+	values := make(ValueList, 100)
+	for i := range values {
+		values[i] = IntValue(i)
+	}
+	values[50] = StringValue("fifty")
+	codec, _ := codecFor(values)
+	data, err := codec.EncodeBinary(values)
+	if err != nil {
+		log.Error("Failed encoding value list: %v", err)
+		t.FailNow()
+	}
+	if bytes.Count(data, []byte("IntValue")) != 1 {
+		log.Error("Expected each tag once in value list encoding, saw %q", data)
+		t.Fail()
+	}
+	decoded, err := codec.DecodeBinary(data)
+	if err != nil || decoded.(ValueList).String() != values.String() {
+		log.Error("Expected value list to round trip, saw %v (%v)", decoded, err)
+		t.Fail()
+	}
+}
+
+func TestRegisterCodecConcurrently(t *testing.T) {
+	tree := genMixedTree()
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i++ {
+			RegisterCodec(StringValue(""), stringValueCodec{})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := tree.MarshalBinary(); err != nil {
+			log.Error("Failed marshaling binary: %v", err)
+			t.Fail()
+		}
+	}
+	wait.Wait()
+}
+
+func genMixedTree() LLRB {
+	tree := NewLLRB()
+	tree.Insert(IntKey(1), StringValue("one"))
+	tree.Insert(IntKey(300), StringValue("with \"quotes\"\n"))
+	tree.Insert(IntKey(-7), BytesValue([]byte{0, 0xff, '\n'}))
+	tree.Insert(IntKey(1000000), BytesValue([]byte{}))
+	return tree
+}
@@ -14,13 +14,25 @@ type memoryNode struct {
 // LLRB implementation
 
 func NewLLRB() LLRB {
-	return NewRedBlackTree(&memoryLLRB{root: nil})
+	return NewRedBlackTree(NewMemoryLLRBImpl())
+}
+
+/*
+Create a new, empty in-memory implementation, for functions like ReadText
+that build a tree from an LLRBImpl; it is a CloneableLLRBImpl
+*/
+func NewMemoryLLRBImpl() LLRBImpl {
+	return &memoryLLRB{root: nil}
 }
 
 func (tree *memoryLLRB) NewNodeImpl(key Key, value Value) NodeImpl {
 	return &memoryNode{key: key, value: value, color: RED}
 }
 
+func (tree *memoryLLRB) NewLLRBImpl() LLRBImpl {
+	return &memoryLLRB{root: nil}
+}
+
 func (tree *memoryLLRB) Root() Node {
 	return tree.root
 }
@@ -36,7 +48,6 @@ func (h *memoryNode) Key() Key {
 }
 
 func (h *memoryNode) SetKey(key Key) {
-	trace.Trace("Setting key of %v to %v", h.key, key)
 	h.key = key
 }
 
@@ -78,6 +89,5 @@ func (h *memoryNode) Color() Color {
 }
 
 func (h *memoryNode) SetColor(c Color) {
-	trace.Trace("Setting color of {%v} to %v", h.Key(), c)
 	h.color = c
 }
@@ -1,15 +1,12 @@
 package redblack
 
 import "math"
+import "math/rand"
 import "testing"
 
-import l4g "code.google.com/p/log4go"
+import stdlog "log"
 
-var log l4g.Logger
-
-func init() {
-	log = l4g.NewDefaultLogger(l4g.INFO)
-}
+var log = testLogger{debug: false}
 
 func TestEmptyTree(t *testing.T) {
 	tree := NewLLRB()
@@ -257,17 +254,176 @@ func Test1Delete1InsertLotsOfKeys(t *testing.T) {
 		if !ok {
 			log.Error("Failed on deletion of key %v", i)
 		} else {
-			ok = checkInsert(tree, IntKey(i), StringValue(string(i)))
+			ok = checkInsert(tree, IntKey(i), StringValue(IntKey(i).String()))
 			if !ok {
-				log.Error("Failed on insertion of key %v, value %v", i)
+				log.Error("Failed on insertion of key %v", i)
+			}
+		}
+		allOk = allOk && ok
+	}
+	if !allOk {
+		t.Fail()
+	}
+
+}
+
+func TestDeleteRange(t *testing.T) {
+	lots := 50
+	genTree := func() LLRB {
+		tree := NewLLRB()
+		for i := 1; i <= lots; i++ {
+			tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		}
+		return tree
+	}
+	ranges := [][2]int{{1, 1}, {1, 10}, {5, 25}, {20, 50}, {50, 50}, {1, 50}, {-5, 3}, {48, 75}, {60, 70}, {10, 5}}
+	allOk := true
+	for _, r := range ranges {
+		low, high := r[0], r[1]
+		tree := genTree()
+		expected := 0
+		for i := 1; i <= lots; i++ {
+			if i >= low && i <= high {
+				expected++
+			}
+		}
+		removed := tree.DeleteRange(IntKey(low), IntKey(high))
+		ok := removed == expected && tree.Size() == lots-expected
+		if !ok {
+			log.Error("Deleting range %v-%v removed %v keys leaving %v, expected %v", low, high, removed, tree.Size(), expected)
+		}
+		for i := 1; i <= lots; i++ {
+			found := tree.Search(IntKey(i)) != nil
+			if found == (i >= low && i <= high) {
+				log.Error("Unexpected presence of key %v after deleting range %v-%v", i, low, high)
+				ok = false
 			}
 		}
+		if !checkInvariants(tree) {
+			log.Error("Invariant check failed after deleting range %v-%v", low, high)
+			ok = false
+		}
 		allOk = allOk && ok
 	}
 	if !allOk {
 		t.Fail()
 	}
+}
+
+func TestRandomInsertDelete(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	allOk := true
+	for i := 0; i < 200 && allOk; i++ {
+		tree := NewLLRB()
+		keys := make(map[int]bool)
+		for j := 0; j < 100 && allOk; j++ {
+			key := random.Intn(150)
+			switch random.Intn(5) {
+			case 0:
+				tree.Delete(IntKey(key))
+				delete(keys, key)
+			case 1:
+				high := key + random.Intn(10)
+				tree.DeleteRange(IntKey(key), IntKey(high))
+				for k := key; k <= high; k++ {
+					delete(keys, k)
+				}
+			default:
+				tree.Insert(IntKey(key), StringValue(IntKey(key).String()))
+				keys[key] = true
+			}
+			if tree.Size() != len(keys) {
+				log.Error("Expected tree of size %v, saw %v", len(keys), tree.Size())
+				allOk = false
+			}
+			if !checkBalance(tree) {
+				log.Error("Invariant check failed\n%v", tree)
+				allOk = false
+			}
+		}
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
+
+func TestDeleteMinMax(t *testing.T) {
+	lots := 50
+	genTree := func() LLRB {
+		tree := NewLLRB()
+		for i := 1; i <= lots; i++ {
+			tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		}
+		return tree
+	}
+	allOk := true
+	{
+		tree := genTree()
+		for i := 1; i <= lots; i++ {
+			tree.DeleteMin()
+			ok := tree.Search(IntKey(i)) == nil && tree.Size() == lots-i && checkBalance(tree)
+			if !ok {
+				log.Error("Failed on deletion of min key %v\n%v", i, tree)
+			}
+			allOk = allOk && ok
+		}
+	}
+	{
+		tree := genTree()
+		for i := lots; i >= 1; i-- {
+			tree.DeleteMax()
+			ok := tree.Search(IntKey(i)) == nil && tree.Size() == i-1 && checkBalance(tree)
+			if !ok {
+				log.Error("Failed on deletion of max key %v\n%v", i, tree)
+			}
+			allOk = allOk && ok
+		}
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
 
+func TestPopMinMax(t *testing.T) {
+	lots := 50
+	tree := NewLLRB()
+	for i := 1; i <= lots; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	allOk := true
+	for low, high := 1, lots; low < high; low, high = low+1, high-1 {
+		key, value := tree.PopMin()
+		if key != IntKey(low) || value.String() != IntKey(low).String() {
+			log.Error("Expected to pop min key %v, saw %v=%v", low, key, value)
+			allOk = false
+		}
+		key, value = tree.PopMax()
+		if key != IntKey(high) || value.String() != IntKey(high).String() {
+			log.Error("Expected to pop max key %v, saw %v=%v", high, key, value)
+			allOk = false
+		}
+		if !checkBalance(tree) {
+			log.Error("Invariant check failed")
+			allOk = false
+		}
+	}
+	if tree.Size() != 0 {
+		log.Error("Expected empty tree after popping all keys, size is %v", tree.Size())
+		allOk = false
+	}
+	if key, value := tree.PopMin(); key != nil || value != nil {
+		log.Error("Expected nothing from empty tree, saw %v=%v", key, value)
+		allOk = false
+	}
+	if key, value := tree.PopMax(); key != nil || value != nil {
+		log.Error("Expected nothing from empty tree, saw %v=%v", key, value)
+		allOk = false
+	}
+	tree.DeleteMin()
+	tree.DeleteMax()
+	if !allOk {
+		t.Fail()
+	}
 }
 
 func dontTestPrint(t *testing.T) {
@@ -338,7 +494,18 @@ func checkInvariants(tree LLRB) bool {
 		checkAllPathsSameNumberBlack(tree) &&
 		checkChildrenOfRedAreBlack(tree) &&
 		checkDepth(tree) &&
-		checkTwoColors(tree)
+		checkTwoColors(tree) &&
+		checkVerify(tree)
+}
+
+func checkBalance(tree LLRB) bool {
+	// same as checkInvariants, but without checkTwoColors: removing keys
+	// can legitimately leave a tree whose nodes are all black
+	return checkBlackRoot(tree) &&
+		checkAllPathsSameNumberBlack(tree) &&
+		checkChildrenOfRedAreBlack(tree) &&
+		checkDepth(tree) &&
+		checkVerify(tree)
 }
 
 func checkBlackRoot(tree LLRB) bool {
@@ -470,6 +637,14 @@ func checkTwoColors(tree LLRB) bool {
 	return success
 }
 
+func checkVerify(tree LLRB) bool {
+	if err := Verify(tree); err != nil {
+		log.Error("Verification failed: %v\n%v", err, tree)
+		return false
+	}
+	return true
+}
+
 // Useful visitor routines
 
 func visitNodes(b Node, visit func(h Node)) {
@@ -513,3 +688,29 @@ func visitPaths(b Node, visit func(path []Node)) {
 		visitor(b, initialPath)
 	}
 }
+
+/*
+Minimal leveled logger for test output; debug messages are only printed
+when debug is set
+*/
+type testLogger struct {
+	debug bool
+}
+
+func (l testLogger) Error(format string, args ...interface{}) {
+	stdlog.Printf("[EROR] "+format, args...)
+}
+
+func (l testLogger) Info(format string, args ...interface{}) {
+	stdlog.Printf("[INFO] "+format, args...)
+}
+
+func (l testLogger) Debug(format string, args ...interface{}) {
+	if l.debug {
+		stdlog.Printf("[DEBG] "+format, args...)
+	}
+}
+
+func (l testLogger) Trace(format string, args ...interface{}) {
+	l.Debug(format, args...)
+}
@@ -0,0 +1,329 @@
+package redblack
+
+import "bytes"
+import "crypto/sha256"
+import "encoding/binary"
+import "errors"
+import "fmt"
+
+//=============================================================================
+//
+// Merkle trees
+//
+//=============================================================================
+
+/*
+Nodes implementing this interface hold a SHA-256 hash over their key, value
+and the hashes of their children, which the tree recomputes whenever any of
+those change
+*/
+type MerkleNodeImpl interface {
+	NodeImpl
+	Hash() []byte
+	SetHash(hash []byte)
+}
+
+/*
+A red-black tree whose root hash commits to its entire contents, and which
+can prove to others that it holds a key and value.  The hash covers the
+shape of the tree as well, so trees holding the same entries may have
+different root hashes if they were built differently.
+
+Keys and values are hashed using their binary encoding, so their types must
+have a registered Codec.  Insert ignores entries that cannot be hashed,
+leaving the tree unchanged; use TryInsert to learn why.
+*/
+type MerkleTree interface {
+	LLRB
+	/*
+		Insert key with value, or return an error and leave the tree
+		unchanged if they cannot be hashed
+	*/
+	TryInsert(key Key, value Value) error
+	/*
+		Return the hash of the root node, or an empty hash if the tree
+		is empty
+	*/
+	RootHash() []byte
+	/*
+		Return a proof that the tree holds key with its current value,
+		or false if the tree does not hold key
+	*/
+	Prove(key Key) (*Proof, bool)
+}
+
+/*
+Proof that a key and value are held in a tree with a particular root hash;
+check it with VerifyProof
+*/
+type Proof struct {
+	Key   Key
+	Value Value
+	/*
+		Hashes of the children of the node holding the key, empty for
+		missing children
+	*/
+	Left, Right []byte
+	/*
+		The ancestors of the node holding the key, from its parent up to
+		the root
+	*/
+	Path []ProofStep
+}
+
+/*
+One ancestor of the node holding a proven key
+*/
+type ProofStep struct {
+	Key   Key
+	Value Value
+	/*
+		Hash of the ancestor's other child, empty if missing
+	*/
+	Sibling []byte
+	/*
+		True if the path to the proven key descends to the ancestor's
+		left child
+	*/
+	FromLeft bool
+}
+
+type merkleTree struct {
+	LLRB
+}
+
+type merkleLLRB struct {
+	memoryLLRB
+}
+
+type merkleNode struct {
+	memoryNode
+	hash []byte
+}
+
+/*
+Create a new, empty in-memory Merkle tree
+*/
+func NewMerkleTree() MerkleTree {
+	return NewMerkleRedBlackTree(&merkleLLRB{})
+}
+
+/*
+Create a new Merkle tree using the provided implementation, whose nodes must
+implement MerkleNodeImpl
+*/
+func NewMerkleRedBlackTree(impl LLRBImpl) MerkleTree {
+	return &merkleTree{NewRedBlackTree(impl)}
+}
+
+func (tree *merkleTree) Clone() LLRB {
+	return &merkleTree{tree.LLRB.Clone()}
+}
+
+func (tree *merkleTree) Insert(key Key, value Value) {
+	tree.TryInsert(key, value)
+}
+
+func (tree *merkleTree) TryInsert(key Key, value Value) error {
+	// check before changing anything, as hashing the new entry partway
+	// through an insert could not be undone
+	if _, err := hashEntry(key, value, nil, nil); err != nil {
+		return err
+	}
+	tree.LLRB.Insert(key, value)
+	return nil
+}
+
+func (tree *merkleTree) RootHash() []byte {
+	return merkleHash(tree.Root())
+}
+
+func (tree *merkleTree) Prove(key Key) (*Proof, bool) {
+	path := make([]ProofStep, 0)
+	h := tree.Root()
+	for h != nil {
+		cmp := key.Compare(h.Key())
+		if cmp == 0 {
+			break
+		}
+		step := ProofStep{Key: h.Key(), Value: h.Value(), FromLeft: cmp < 0}
+		if step.FromLeft {
+			step.Sibling, h = merkleHash(h.Right()), h.Left()
+		} else {
+			step.Sibling, h = merkleHash(h.Left()), h.Right()
+		}
+		path = append(path, step)
+	}
+	if h == nil {
+		return nil, false
+	}
+	// steps were collected from the root down, but are checked upward
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return &Proof{h.Key(), h.Value(), merkleHash(h.Left()), merkleHash(h.Right()), path}, true
+}
+
+/*
+Return true if proof shows that its key and value are held in the tree whose
+root hash is rootHash
+*/
+func VerifyProof(rootHash []byte, proof *Proof) bool {
+	hash, err := hashEntry(proof.Key, proof.Value, proof.Left, proof.Right)
+	for _, step := range proof.Path {
+		if err != nil {
+			return false
+		}
+		if step.FromLeft {
+			hash, err = hashEntry(step.Key, step.Value, hash, step.Sibling)
+		} else {
+			hash, err = hashEntry(step.Key, step.Value, step.Sibling, hash)
+		}
+	}
+	return err == nil && bytes.Equal(hash, rootHash)
+}
+
+/*
+Encode the proof in binary, using the codecs registered for its keys and
+values
+*/
+func (proof *Proof) MarshalBinary() ([]byte, error) {
+	data, err := appendProofEntry(nil, proof.Key, proof.Value)
+	if err != nil {
+		return nil, err
+	}
+	data = appendBytes(appendBytes(data, proof.Left), proof.Right)
+	data = binary.AppendUvarint(data, uint64(len(proof.Path)))
+	for _, step := range proof.Path {
+		if data, err = appendProofEntry(data, step.Key, step.Value); err != nil {
+			return nil, err
+		}
+		data = appendBytes(data, step.Sibling)
+		if step.FromLeft {
+			data = append(data, 1)
+		} else {
+			data = append(data, 0)
+		}
+	}
+	return data, nil
+}
+
+/*
+Decode a proof from data produced by MarshalBinary
+*/
+func (proof *Proof) UnmarshalBinary(data []byte) error {
+	var err error
+	if proof.Key, proof.Value, data, err = readProofEntry(data); err != nil {
+		return err
+	}
+	if proof.Left, data, err = readBytes(data); err != nil {
+		return err
+	}
+	if proof.Right, data, err = readBytes(data); err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errors.New("malformed path length")
+	}
+	data = data[n:]
+	proof.Path = make([]ProofStep, 0)
+	for i := uint64(0); i < count; i++ {
+		var step ProofStep
+		if step.Key, step.Value, data, err = readProofEntry(data); err != nil {
+			return err
+		}
+		if step.Sibling, data, err = readBytes(data); err != nil {
+			return err
+		}
+		if len(data) == 0 || data[0] > 1 {
+			return errors.New("malformed path step")
+		}
+		step.FromLeft, data = data[0] == 1, data[1:]
+		proof.Path = append(proof.Path, step)
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%v unexpected bytes after proof", len(data))
+	}
+	return nil
+}
+
+func appendProofEntry(data []byte, key Key, value Value) ([]byte, error) {
+	data, err := appendBinary(data, key)
+	if err != nil {
+		return nil, err
+	}
+	return appendBinary(data, value)
+}
+
+func readProofEntry(data []byte) (Key, Value, []byte, error) {
+	k, data, err := readBinary(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	v, data, err := readBinary(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, value, err := asEntry(k, v)
+	return key, value, data, err
+}
+
+func merkleHash(h Node) []byte {
+	if h == nil {
+		return []byte{}
+	}
+	return h.(*node).NodeImpl.(MerkleNodeImpl).Hash()
+}
+
+/*
+Hash a node's key and value together with its children's hashes; keys and
+values are encoded as by appendBinary, so a hash commits to their exact
+contents, and each part is length prefixed.  Keys and values without a
+registered codec cannot be hashed.
+*/
+func hashEntry(key Key, value Value, left, right []byte) ([]byte, error) {
+	data, err := appendBinary(nil, key)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = appendBinary(data, value); err != nil {
+		return nil, err
+	}
+	data = appendBytes(appendBytes(data, left), right)
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+/*
+Hash an entry held in a tree, panicking if it cannot be hashed; entries are
+checked before they are added, so this cannot happen unless a node's value
+is changed directly
+*/
+func mustHashEntry(key Key, value Value, left, right []byte) []byte {
+	hash, err := hashEntry(key, value, left, right)
+	if err != nil {
+		panic(fmt.Sprintf("cannot hash entry for key %v: %v", key, err))
+	}
+	return hash
+}
+
+// LLRB implementation
+
+func (tree *merkleLLRB) NewNodeImpl(key Key, value Value) NodeImpl {
+	return &merkleNode{memoryNode: memoryNode{key: key, value: value, color: RED}}
+}
+
+func (tree *merkleLLRB) NewLLRBImpl() LLRBImpl {
+	return &merkleLLRB{}
+}
+
+// Node implementation
+
+func (h *merkleNode) Hash() []byte {
+	return h.hash
+}
+
+func (h *merkleNode) SetHash(hash []byte) {
+	h.hash = hash
+}
@@ -0,0 +1,177 @@
+package redblack
+
+import "bytes"
+import "testing"
+
+func TestMerkleRootHash(t *testing.T) {
+	tree := NewMerkleTree()
+	if len(tree.RootHash()) != 0 {
+		log.Error("Expected empty hash for empty tree, saw %x", tree.RootHash())
+		t.Fail()
+	}
+	for i := 1; i <= 50; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	if !checkMerkleHashes(tree) {
+		t.Fail()
+	}
+	before := tree.RootHash()
+	tree.Insert(IntKey(25), StringValue("changed"))
+	changed := tree.RootHash()
+	if bytes.Equal(before, changed) {
+		log.Error("Expected root hash to change with a value")
+		t.Fail()
+	}
+	if !checkMerkleHashes(tree) {
+		t.Fail()
+	}
+	for i := 1; i <= 50; i += 3 {
+		tree.Delete(IntKey(i))
+	}
+	tree.DeleteRange(IntKey(30), IntKey(35))
+	tree.PopMax()
+	if !checkMerkleHashes(tree) {
+		t.Fail()
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	tree := NewMerkleTree()
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	root := tree.RootHash()
+	for i := 1; i <= 100; i++ {
+		proof, ok := tree.Prove(IntKey(i))
+		if !ok || !VerifyProof(root, proof) {
+			log.Error("Failed to prove key %v", i)
+			t.Fail()
+		}
+	}
+	if _, ok := tree.Prove(IntKey(101)); ok {
+		log.Error("Expected no proof for missing key")
+		t.Fail()
+	}
+	proof, _ := tree.Prove(IntKey(42))
+	proof.Value = StringValue("forged")
+	if VerifyProof(root, proof) {
+		log.Error("Expected proof with forged value to fail")
+		t.Fail()
+	}
+	proof, _ = tree.Prove(IntKey(42))
+	proof.Path[0].FromLeft = !proof.Path[0].FromLeft
+	if VerifyProof(root, proof) {
+		log.Error("Expected proof with altered path to fail")
+		t.Fail()
+	}
+	proof, _ = tree.Prove(IntKey(42))
+	tree.Insert(IntKey(7), StringValue("changed"))
+	if VerifyProof(tree.RootHash(), proof) {
+		log.Error("Expected old proof to fail against new root hash")
+		t.Fail()
+	}
+}
+
+func TestMerkleProofRoundTrip(t *testing.T) {
+	tree := NewMerkleTree()
+	for i := 1; i <= 20; i++ {
+		tree.Insert(IntKey(i), BytesValue([]byte{byte(i)}))
+	}
+	proof, _ := tree.Prove(IntKey(13))
+	data, err := proof.MarshalBinary()
+	if err != nil {
+		log.Error("Failed marshaling proof: %v", err)
+		t.FailNow()
+	}
+	var received Proof
+	if err := received.UnmarshalBinary(data); err != nil {
+		log.Error("Failed unmarshaling proof: %v", err)
+		t.FailNow()
+	}
+	if !VerifyProof(tree.RootHash(), &received) || received.Key != IntKey(13) {
+		log.Error("Expected received proof of key 13 to verify, saw key %v", received.Key)
+		t.Fail()
+	}
+	if err := received.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		log.Error("Expected error unmarshaling truncated proof")
+		t.Fail()
+	}
+}
+
+func TestMerkleClone(t *testing.T) {
+	tree := NewMerkleTree()
+	for i := 1; i <= 30; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	before := tree.RootHash()
+	clone := tree.Clone().(MerkleTree)
+	clone.Delete(IntKey(10))
+	if !bytes.Equal(before, tree.RootHash()) || bytes.Equal(before, clone.RootHash()) {
+		log.Error("Expected only the clone's root hash to change")
+		t.Fail()
+	}
+	if !checkMerkleHashes(tree) || !checkMerkleHashes(clone) {
+		t.Fail()
+	}
+}
+
+func TestMerkleUnregisteredValue(t *testing.T) {
+	tree := NewMerkleTree()
+	for i := 1; i <= 20; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	before := tree.RootHash()
+	// inserting over an existing key, and adding a new one, both pass
+	// through nodes that would be rebalanced
+	for _, key := range []IntKey{7, 21} {
+		if err := tree.TryInsert(key, unregisteredValue{}); err == nil {
+			log.Error("Expected error inserting value without a codec for key %v", key)
+			t.Fail()
+		}
+		tree.Insert(key, ValueList{unregisteredValue{}})
+	}
+	if err := Verify(tree); err != nil {
+		log.Error("Tree invalid after rejected inserts: %v", err)
+		t.Fail()
+	}
+	if !bytes.Equal(before, tree.RootHash()) || !checkMerkleHashes(tree) {
+		log.Error("Expected rejected inserts to leave the tree unchanged")
+		t.Fail()
+	}
+	if tree.Search(IntKey(7)) != StringValue("7") || tree.Search(IntKey(21)) != nil {
+		log.Error("Expected rejected inserts to leave values unchanged")
+		t.Fail()
+	}
+}
+
+func TestVerifyProofUnregisteredValue(t *testing.T) {
+	tree := NewMerkleTree()
+	tree.Insert(IntKey(1), StringValue("one"))
+	proof, _ := tree.Prove(IntKey(1))
+	proof.Value = unregisteredValue{}
+	if VerifyProof(tree.RootHash(), proof) {
+		log.Error("Expected proof with value that cannot be hashed to fail")
+		t.Fail()
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+/*
+Check that the hash of every node matches its contents
+*/
+func checkMerkleHashes(tree MerkleTree) bool {
+	ok := true
+	walk(tree.Root(), func(h Node) {
+		expected := mustHashEntry(h.Key(), h.Value(), merkleHash(h.Left()), merkleHash(h.Right()))
+		if !bytes.Equal(merkleHash(h), expected) {
+			log.Error("Hash of key %v is %x, expected %x", h.Key(), merkleHash(h), expected)
+			ok = false
+		}
+	})
+	return ok && checkBalance(tree)
+}
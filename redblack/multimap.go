@@ -0,0 +1,164 @@
+package redblack
+
+import "reflect"
+import "strings"
+
+//=============================================================================
+//
+// Multimaps
+//
+//=============================================================================
+
+/*
+The values held for a single key in a multimap, in the order they were added
+*/
+type ValueList []Value
+
+func (values ValueList) String() string {
+	s := make([]string, len(values))
+	for i, value := range values {
+		s[i] = value.String()
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+/*
+A red-black tree that can hold more than one value for each key, such as
+for a secondary index on non-unique keys.  Each node holds a ValueList, so
+Search returns all of the values for a key, and Size counts distinct keys.
+Lists returned by Search must not be changed, so use GetAll for a copy that
+may be.
+*/
+type MultiMap interface {
+	LLRB
+	/*
+		Add value to the values held for key, after any already there
+	*/
+	Add(key Key, value Value)
+	/*
+		Return the values held for key in the order they were added, or nil
+		if there are none
+	*/
+	GetAll(key Key) []Value
+	/*
+		Delete the first value held for key that is equal to value, returning
+		true if one was found; the key is removed with its last value
+	*/
+	DeleteOne(key Key, value Value) bool
+	/*
+		Delete key and all of its values, returning the number of values
+		removed
+	*/
+	DeleteAll(key Key) int
+	/*
+		Return the number of values held for key
+	*/
+	Count(key Key) int
+}
+
+type multiMap struct {
+	LLRB
+	mark *listMark
+}
+
+/*
+Left in the first unused element of each list a multimap may append to in
+place.  Lists shared with a clone, or inserted by callers, do not hold the
+mark of the tree adding to them, and so are copied first.
+*/
+type listMark struct {
+	_ byte
+}
+
+func (mark *listMark) String() string {
+	return "mark"
+}
+
+/*
+Create a new, empty multimap
+*/
+func NewMultiMap() MultiMap {
+	return &multiMap{NewLLRB(), &listMark{}}
+}
+
+func (tree *multiMap) Clone() LLRB {
+	// every existing list is now shared, so neither tree may append to them
+	tree.mark = &listMark{}
+	return &multiMap{tree.LLRB.Clone(), &listMark{}}
+}
+
+func (tree *multiMap) Add(key Key, value Value) {
+	values := tree.values(key)
+	if n := len(values); n < cap(values) && values[:n+1][n] == Value(tree.mark) {
+		values = append(values, value)
+	} else {
+		// leave room to grow, so that adding k values takes O(k) time
+		values = append(make(ValueList, 0, 2*n+2), values...)
+		values = append(values, value)
+	}
+	if n := len(values); n < cap(values) {
+		values[:n+1][n] = tree.mark
+	}
+	tree.Insert(key, values)
+}
+
+func (tree *multiMap) Search(key Key) Value {
+	value := tree.LLRB.Search(key)
+	if values, ok := value.(ValueList); ok {
+		// so that callers appending to the list copy it, rather than
+		// writing over room kept for Add
+		return values[:len(values):len(values)]
+	}
+	return value
+}
+
+func (tree *multiMap) GetAll(key Key) []Value {
+	values := tree.values(key)
+	if values == nil {
+		return nil
+	}
+	return append([]Value{}, values...)
+}
+
+func (tree *multiMap) DeleteOne(key Key, value Value) bool {
+	values := tree.values(key)
+	for i, v := range values {
+		if reflect.DeepEqual(v, value) {
+			if len(values) == 1 {
+				tree.Delete(key)
+			} else {
+				remaining := append(append(ValueList{}, values[:i]...), values[i+1:]...)
+				tree.Insert(key, remaining)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (tree *multiMap) DeleteAll(key Key) int {
+	count := tree.Count(key)
+	if count > 0 {
+		tree.Delete(key)
+	}
+	return count
+}
+
+func (tree *multiMap) Count(key Key) int {
+	return len(tree.values(key))
+}
+
+/*
+Return the values held for key without copying them; a node holding a
+single value rather than a ValueList is treated as a list of one
+*/
+func (tree *multiMap) values(key Key) ValueList {
+	switch value := tree.LLRB.Search(key).(type) {
+	case nil:
+		return nil
+	case ValueList:
+		return value
+	default:
+		return ValueList{value}
+	}
+}
@@ -0,0 +1,166 @@
+package redblack
+
+import "fmt"
+import "testing"
+
+func TestMultiMap(t *testing.T) {
+	tree := NewMultiMap()
+	for i := 0; i < 30; i++ {
+		tree.Add(IntKey(i%10), StringValue(IntKey(i).String()))
+	}
+	if tree.Size() != 10 || !checkBalance(tree) {
+		log.Error("Expected 10 keys, saw %v", tree.Size())
+		t.Fail()
+	}
+	for k := 0; k < 10; k++ {
+		expected := fmt.Sprintf("[%v %v %v]", k, k+10, k+20)
+		if values := tree.GetAll(IntKey(k)); fmt.Sprint(values) != expected {
+			log.Error("Expected values %v for key %v, saw %v", expected, k, values)
+			t.Fail()
+		}
+		if tree.Count(IntKey(k)) != 3 {
+			log.Error("Expected 3 values for key %v, saw %v", k, tree.Count(IntKey(k)))
+			t.Fail()
+		}
+	}
+	if tree.GetAll(IntKey(10)) != nil || tree.Count(IntKey(10)) != 0 {
+		log.Error("Expected no values for missing key")
+		t.Fail()
+	}
+	if search := tree.Search(IntKey(3)); search.String() != "[3 13 23]" {
+		log.Error("Expected search to return all values, saw %v", search)
+		t.Fail()
+	}
+}
+
+func TestMultiMapDelete(t *testing.T) {
+	tree := NewMultiMap()
+	for _, v := range []string{"a", "b", "a", "c"} {
+		tree.Add(IntKey(1), StringValue(v))
+	}
+	tree.Add(IntKey(2), StringValue("z"))
+	values := tree.GetAll(IntKey(1))
+	if !tree.DeleteOne(IntKey(1), StringValue("a")) {
+		log.Error("Expected to delete value a")
+		t.Fail()
+	}
+	if fmt.Sprint(tree.GetAll(IntKey(1))) != "[b a c]" {
+		log.Error("Expected only the first a to be deleted, saw %v", tree.GetAll(IntKey(1)))
+		t.Fail()
+	}
+	if fmt.Sprint(values) != "[a b a c]" {
+		log.Error("Expected values returned earlier to be unchanged, saw %v", values)
+		t.Fail()
+	}
+	if tree.DeleteOne(IntKey(1), StringValue("d")) || tree.DeleteOne(IntKey(3), StringValue("a")) {
+		log.Error("Expected deleting missing values to fail")
+		t.Fail()
+	}
+	if !tree.DeleteOne(IntKey(2), StringValue("z")) || tree.Size() != 1 {
+		log.Error("Expected deleting last value to remove key, saw %v keys", tree.Size())
+		t.Fail()
+	}
+	if removed := tree.DeleteAll(IntKey(1)); removed != 3 || tree.Size() != 0 {
+		log.Error("Expected to delete 3 values leaving no keys, deleted %v leaving %v", removed, tree.Size())
+		t.Fail()
+	}
+	if removed := tree.DeleteAll(IntKey(1)); removed != 0 {
+		log.Error("Expected to delete no values for missing key, deleted %v", removed)
+		t.Fail()
+	}
+}
+
+func TestMultiMapManyValues(t *testing.T) {
+	tree := NewMultiMap()
+	for i := 0; i < 10000; i++ {
+		tree.Add(IntKey(i%3), IntValue(i))
+	}
+	allocs := testing.AllocsPerRun(1000, func() {
+		tree.Add(IntKey(1), IntValue(0))
+	})
+	// appending in place allocates only when a list grows, rather than
+	// copying the whole list on every Add
+	if allocs > 1 {
+		log.Error("Expected amortized constant allocations per Add, saw %v", allocs)
+		t.Fail()
+	}
+	if tree.Count(IntKey(0)) != 3334 || tree.Count(IntKey(1)) != 4334 {
+		log.Error("Expected 3334 and 4334 values, saw %v and %v", tree.Count(IntKey(0)), tree.Count(IntKey(1)))
+		t.Fail()
+	}
+}
+
+func TestMultiMapClone(t *testing.T) {
+	tree := NewMultiMap()
+	for i := 0; i < 100; i++ {
+		tree.Add(IntKey(i%10), IntValue(i))
+	}
+	clone := tree.Clone().(MultiMap)
+	tree.Add(IntKey(5), IntValue(-1))
+	clone.Add(IntKey(5), IntValue(-2))
+	tree.Add(IntKey(5), IntValue(-3))
+	original, cloned := tree.GetAll(IntKey(5)), clone.GetAll(IntKey(5))
+	if len(original) != 12 || original[10] != IntValue(-1) || original[11] != IntValue(-3) {
+		log.Error("Unexpected values in original after adding to clone: %v", original)
+		t.Fail()
+	}
+	if len(cloned) != 11 || cloned[10] != IntValue(-2) {
+		log.Error("Unexpected values in clone after adding to original: %v", cloned)
+		t.Fail()
+	}
+}
+
+func TestMultiMapAliasing(t *testing.T) {
+	tree := NewMultiMap()
+	tree.Add(IntKey(1), IntValue(1))
+	tree.Add(IntKey(1), IntValue(2))
+	found := append(tree.Search(IntKey(1)).(ValueList), IntValue(-1))
+	tree.Add(IntKey(1), IntValue(3))
+	if found[2] != IntValue(-1) || tree.GetAll(IntKey(1))[2] != IntValue(3) {
+		log.Error("Expected Search result and Add not to share a list, saw %v and %v", found, tree.GetAll(IntKey(1)))
+		t.Fail()
+	}
+	inserted := make(ValueList, 1, 10)
+	inserted[0] = IntValue(1)
+	tree.Insert(IntKey(2), inserted)
+	tree.Add(IntKey(2), IntValue(2))
+	if inserted[:2][1] != nil {
+		log.Error("Expected Add to copy a list it did not create, saw %v", inserted[:2])
+		t.Fail()
+	}
+}
+
+func TestMultiMapRoundTrip(t *testing.T) {
+	tree := NewMultiMap()
+	tree.Add(IntKey(1), StringValue("one"))
+	tree.Add(IntKey(1), IntValue(1))
+	tree.Add(IntKey(2), BytesValue([]byte{2}))
+	data, err := tree.MarshalBinary()
+	if err != nil {
+		log.Error("Failed marshaling binary: %v", err)
+		t.FailNow()
+	}
+	copied := NewMultiMap()
+	if err := copied.UnmarshalBinary(data); err != nil {
+		log.Error("Failed unmarshaling binary: %v", err)
+		t.FailNow()
+	}
+	text, err := copied.MarshalJSON()
+	if err != nil {
+		log.Error("Failed marshaling JSON: %v", err)
+		t.FailNow()
+	}
+	again := NewMultiMap()
+	if err := again.UnmarshalJSON(text); err != nil {
+		log.Error("Failed unmarshaling JSON: %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(again.GetAll(IntKey(1)), again.GetAll(IntKey(2))) != "[one 1] [\x02]" {
+		log.Error("Expected values to survive round trip, saw %v and %v", again.GetAll(IntKey(1)), again.GetAll(IntKey(2)))
+		t.Fail()
+	}
+	if _, ok := again.GetAll(IntKey(1))[1].(IntValue); !ok {
+		log.Error("Expected value types to survive round trip")
+		t.Fail()
+	}
+}
@@ -0,0 +1,133 @@
+package redblack
+
+import "fmt"
+
+//=============================================================================
+//
+// Numeric trees
+//
+//=============================================================================
+
+/*
+Generalized interface for values that have a numeric magnitude
+*/
+type NumericValue interface {
+	Value
+	Float64() float64
+}
+
+type IntValue int
+
+func (value IntValue) Float64() float64 {
+	return float64(value)
+}
+
+func (value IntValue) String() string {
+	return fmt.Sprintf("%v", int(value))
+}
+
+type FloatValue float64
+
+func (value FloatValue) Float64() float64 {
+	return float64(value)
+}
+
+func (value FloatValue) String() string {
+	return fmt.Sprintf("%v", float64(value))
+}
+
+/*
+A red-black tree of numeric values that can total, count, and find the
+extremes of the values in any range of keys in logarithmic time
+*/
+type NumericTree interface {
+	LLRB
+	/*
+		Return the sum of the values with keys between low and high (inclusive)
+	*/
+	Sum(low, high Key) float64
+	/*
+		Return the smallest value with a key between low and high (inclusive),
+		or nil if there are none
+	*/
+	MinValue(low, high Key) NumericValue
+	/*
+		Return the largest value with a key between low and high (inclusive),
+		or nil if there are none
+	*/
+	MaxValue(low, high Key) NumericValue
+	/*
+		Return the number of keys between low and high (inclusive)
+	*/
+	Count(low, high Key) int
+}
+
+type numericSummary struct {
+	count    int
+	sum      float64
+	min, max NumericValue
+}
+
+type numericMonoid struct{}
+
+type numericTree struct {
+	AugmentedLLRB
+}
+
+/*
+Create a new, empty numeric tree; all values inserted must be NumericValues
+*/
+func NewNumericTree() NumericTree {
+	return &numericTree{NewAugmentedLLRB(numericMonoid{})}
+}
+
+func (tree *numericTree) Clone() LLRB {
+	return &numericTree{tree.AugmentedLLRB.Clone().(AugmentedLLRB)}
+}
+
+func (tree *numericTree) Sum(low, high Key) float64 {
+	return tree.summarize(low, high).sum
+}
+
+func (tree *numericTree) MinValue(low, high Key) NumericValue {
+	return tree.summarize(low, high).min
+}
+
+func (tree *numericTree) MaxValue(low, high Key) NumericValue {
+	return tree.summarize(low, high).max
+}
+
+func (tree *numericTree) Count(low, high Key) int {
+	return tree.summarize(low, high).count
+}
+
+func (tree *numericTree) summarize(low, high Key) numericSummary {
+	return tree.Aggregate(low, high).(numericSummary)
+}
+
+func (m numericMonoid) Identity() interface{} {
+	return numericSummary{}
+}
+
+func (m numericMonoid) Combine(a, b interface{}) interface{} {
+	s1, s2 := a.(numericSummary), b.(numericSummary)
+	if s1.count == 0 {
+		return s2
+	}
+	if s2.count == 0 {
+		return s1
+	}
+	s := numericSummary{count: s1.count + s2.count, sum: s1.sum + s2.sum, min: s1.min, max: s1.max}
+	if s2.min.Float64() < s.min.Float64() {
+		s.min = s2.min
+	}
+	if s2.max.Float64() > s.max.Float64() {
+		s.max = s2.max
+	}
+	return s
+}
+
+func (m numericMonoid) Measure(key Key, value Value) interface{} {
+	v := value.(NumericValue)
+	return numericSummary{count: 1, sum: v.Float64(), min: v, max: v}
+}
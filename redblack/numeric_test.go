@@ -0,0 +1,71 @@
+package redblack
+
+import "testing"
+
+func TestNumericQueries(t *testing.T) {
+	lots := 100
+	tree := NewNumericTree()
+	values := make(map[int]int)
+	for i := 1; i <= lots; i++ {
+		// values rise and fall so extremes aren't simply at the ends
+		values[i] = (i * 37) % 101
+		tree.Insert(IntKey(i), IntValue(values[i]))
+	}
+	for i := 10; i <= lots; i += 10 {
+		tree.Delete(IntKey(i))
+		delete(values, i)
+	}
+	allOk := true
+	for low := -3; low <= lots; low += 4 {
+		for high := low; high <= lots+3; high += 9 {
+			count, sum := 0, 0
+			var min, max NumericValue
+			for i := low; i <= high; i++ {
+				if v, ok := values[i]; ok {
+					count++
+					sum += v
+					if min == nil || v < int(min.(IntValue)) {
+						min = IntValue(v)
+					}
+					if max == nil || v > int(max.(IntValue)) {
+						max = IntValue(v)
+					}
+				}
+			}
+			if found := tree.Count(IntKey(low), IntKey(high)); found != count {
+				log.Error("Expected count %v for keys %v-%v, saw %v", count, low, high, found)
+				allOk = false
+			}
+			if found := tree.Sum(IntKey(low), IntKey(high)); found != float64(sum) {
+				log.Error("Expected sum %v for keys %v-%v, saw %v", sum, low, high, found)
+				allOk = false
+			}
+			if found := tree.MinValue(IntKey(low), IntKey(high)); found != min {
+				log.Error("Expected min %v for keys %v-%v, saw %v", min, low, high, found)
+				allOk = false
+			}
+			if found := tree.MaxValue(IntKey(low), IntKey(high)); found != max {
+				log.Error("Expected max %v for keys %v-%v, saw %v", max, low, high, found)
+				allOk = false
+			}
+		}
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
+
+func TestNumericFloatValues(t *testing.T) {
+	tree := NewNumericTree()
+	tree.Insert(IntKey(1), FloatValue(1.5))
+	tree.Insert(IntKey(2), FloatValue(-2.25))
+	tree.Insert(IntKey(3), FloatValue(4))
+	if sum := tree.Sum(IntKey(1), IntKey(3)); sum != 3.25 {
+		log.Error("Expected sum 3.25, saw %v", sum)
+		t.Fail()
+	}
+	if min := tree.MinValue(IntKey(1), IntKey(2)); min != FloatValue(-2.25) {
+		log.Error("Expected min -2.25, saw %v", min)
+		t.Fail()
+	}
+}
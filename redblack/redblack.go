@@ -3,14 +3,6 @@ package redblack
 import "fmt"
 import "strings"
 
-import l4g "code.google.com/p/log4go"
-
-var trace l4g.Logger
-
-func init() {
-	trace = l4g.NewDefaultLogger(l4g.ERROR)
-}
-
 const (
 	RED   = Color(true)
 	BLACK = Color(false)
@@ -57,11 +49,97 @@ type LLRB interface {
 		Delete the indicated key and its corresponding value from the tree
 	*/
 	Delete(key Key)
+	/*
+		Delete all keys between low and high (inclusive) and their corresponding
+		values from the tree, returning the number of keys removed
+	*/
+	DeleteRange(low, high Key) int
+	/*
+		Delete the smallest key and its corresponding value from the tree
+	*/
+	DeleteMin()
+	/*
+		Delete the largest key and its corresponding value from the tree
+	*/
+	DeleteMax()
+	/*
+		Delete the smallest key from the tree, returning it and its value;
+		returns nil for both if the tree is empty
+	*/
+	PopMin() (Key, Value)
+	/*
+		Delete the largest key from the tree, returning it and its value;
+		returns nil for both if the tree is empty
+	*/
+	PopMax() (Key, Value)
 	/*
 		Return the number of keys in the tree
 	*/
 	Size() int
+	/*
+		Return the number of nodes on the longest path from the root
+	*/
+	Height() int
+	/*
+		Return the number of black nodes on any path from the root
+	*/
+	BlackHeight() int
+	/*
+		Return a summary of the shape of the tree
+	*/
+	Shape() Shape
 	String() string
+	/*
+		Encode the keys and values in the tree as a JSON array, in key order
+	*/
+	MarshalJSON() ([]byte, error)
+	/*
+		Replace the contents of the tree with keys and values decoded from
+		JSON produced by MarshalJSON
+	*/
+	UnmarshalJSON(data []byte) error
+	/*
+		Encode the keys and values in the tree in a compact binary form
+	*/
+	MarshalBinary() ([]byte, error)
+	/*
+		Replace the contents of the tree with keys and values decoded from
+		data produced by MarshalBinary
+	*/
+	UnmarshalBinary(data []byte) error
+	/*
+		Return the tracer receiving events from this tree, or nil if none
+	*/
+	Tracer() Tracer
+	/*
+		Send events describing changes to the tree to tracer; nil disables
+		tracing
+	*/
+	SetTracer(tracer Tracer)
+	/*
+		Return the statistics gathered since they were enabled or last
+		reset; all zero if statistics are not enabled.  Unlike other
+		methods, this and ResetStats may be called from any goroutine.
+	*/
+	Stats() Stats
+	/*
+		Set all statistics back to zero
+	*/
+	ResetStats()
+	/*
+		Start or stop gathering statistics; they are off by default, and
+		disabling them discards any gathered so far.  Not safe to call
+		while other goroutines may be reading statistics.
+	*/
+	SetStatsEnabled(enabled bool)
+	/*
+		Return a new tree holding the same keys and values, which shares
+		its nodes with this tree until either tree changes them.  Trees
+		whose implementation is not a CloneableLLRBImpl are instead copied
+		node by node into a new in-memory tree.  The clone starts without
+		a tracer or statistics.
+	*/
+	Clone() LLRB
 
 	// Internal methods
 
@@ -93,13 +171,21 @@ type LLRBImpl interface {
 
 type llrb struct {
 	LLRBImpl
+	monoid Monoid
+	tracer Tracer
+	stats  *statsCounter
+	owner  *owner
 }
 
 /*
 Create a new red-black tree using the provided implementation
 */
 func NewRedBlackTree(impl LLRBImpl) LLRB {
-	return &llrb{impl}
+	tree := &llrb{LLRBImpl: impl}
+	if augmented, ok := impl.(AugmentedLLRBImpl); ok {
+		tree.monoid = augmented.Monoid()
+	}
+	return tree
 }
 
 //
@@ -108,7 +194,12 @@ func NewRedBlackTree(impl LLRBImpl) LLRB {
 
 func (tree *llrb) NewNode(key Key, value Value) Node {
 	// return &memoryNode{key: key, value: value, color: RED}
-	return &node{tree.NewNodeImpl(key, value)}
+	if tree.stats != nil {
+		tree.stats.allocations.Add(1)
+	}
+	h := &node{tree.NewNodeImpl(key, value), tree.owner}
+	tree.augment(h)
+	return h
 }
 
 func (tree *llrb) Search(key Key) Value {
@@ -116,8 +207,11 @@ func (tree *llrb) Search(key Key) Value {
 }
 
 func (tree *llrb) search(h Node, key Key) Value {
-	for h != nil {
-		cmp := key.Compare(h.Key())
+	for depth := 1; h != nil; depth++ {
+		if tree.stats != nil {
+			tree.stats.reached(depth)
+		}
+		cmp := tree.compare(key, h.Key())
 		if cmp == 0 {
 			return h.Value()
 		} else if cmp < 0 {
@@ -130,52 +224,100 @@ func (tree *llrb) search(h Node, key Key) Value {
 }
 
 func (tree *llrb) Insert(key Key, value Value) {
+	tree.trace(TraceInsert, key)
 	tree.SetRoot(tree.insert(tree.Root(), key, value))
 	tree.Root().SetColor(BLACK)
 }
 
 func (tree *llrb) Delete(key Key) {
-	newRoot := tree.delete(tree.Root(), key)
-	trace.Trace("Before set root to %v\n%v", newRoot, tree)
-	tree.SetRoot(newRoot)
-	trace.Trace("After set root to %v\n%v", newRoot, tree)
+	tree.SetRoot(tree.delete(tree.Root(), key))
 	if tree.Root() != nil {
 		tree.Root().SetColor(BLACK)
 	}
 }
 
-func (tree *llrb) Size() int {
-	var count func(h Node) int
-	count = func(h Node) int {
-		if h != nil {
-			return 1 + count(h.Left()) + count(h.Right())
-		}
+func (tree *llrb) DeleteRange(low, high Key) int {
+	if tree.Root() == nil || low.Compare(high) > 0 {
 		return 0
 	}
-	return count(tree.Root())
+	if tree.tracer != nil {
+		tree.traceRange(tree.Root(), low, high)
+	}
+	before, rest := tree.split(tree.Root(), low, false)
+	middle, after := tree.split(rest, high, true)
+	tree.SetRoot(tree.concat(before, after))
+	return size(middle)
+}
+
+func (tree *llrb) DeleteMin() {
+	tree.PopMin()
+}
+
+func (tree *llrb) DeleteMax() {
+	tree.PopMax()
+}
+
+func (tree *llrb) PopMin() (Key, Value) {
+	if tree.Root() == nil {
+		return nil, nil
+	}
+	key := tree.Root().min()
+	value := tree.search(tree.Root(), key)
+	tree.trace(TraceDelete, key)
+	tree.SetRoot(blacken(tree.deleteMin(tree.Root())))
+	return key, value
+}
+
+func (tree *llrb) PopMax() (Key, Value) {
+	if tree.Root() == nil {
+		return nil, nil
+	}
+	key := tree.Root().max()
+	value := tree.search(tree.Root(), key)
+	tree.trace(TraceDelete, key)
+	tree.SetRoot(blacken(tree.deleteMax(tree.Root())))
+	return key, value
+}
+
+func (tree *llrb) Size() int {
+	return size(tree.Root())
 }
 
 func (tree *llrb) String() string {
 	return tree.Root().String()
 }
 
+func (tree *llrb) Tracer() Tracer {
+	return tree.tracer
+}
+
+func (tree *llrb) SetTracer(tracer Tracer) {
+	tree.tracer = tracer
+}
+
 // LLRB implementation
 
 func (tree *llrb) insert(h Node, key Key, value Value) Node {
+	if tree.stats != nil {
+		tree.stats.enter()
+		defer tree.stats.leave()
+	}
 	// NOTE this is a check for the sentinel
 	if h == nil {
 		return tree.NewNode(key, value)
 	}
+	h = tree.own(h)
 	if isRed(h.Left()) && isRed(h.Right()) {
-		h.flipColors()
+		tree.flipColors(h)
 	}
-	cmp := key.Compare(h.Key())
+	cmp := tree.compare(key, h.Key())
 	if cmp == 0 {
 		h.SetValue(value)
+		tree.augment(h)
 	} else if cmp < 0 {
-		h.SetLeft(tree.insert(h.Left(), key, value))
+		tree.setLeft(h, tree.insert(h.Left(), key, value))
 	} else if cmp > 0 {
-		h.SetRight(tree.insert(h.Right(), key, value))
+		tree.setRight(h, tree.insert(h.Right(), key, value))
 	}
 	if isRed(h.Right()) {
 		h = tree.rotateLeft(h)
@@ -190,16 +332,17 @@ func (tree *llrb) delete(h Node, key Key) Node {
 	if h == nil {
 		return nil
 	}
-	trace.Trace("Deleting %v from \n%v", key, tree)
-	if key.Compare(h.Key()) < 0 {
-		trace.Trace("Key %v < {%v}", key, h.Key())
+	h = tree.own(h)
+	if tree.stats != nil {
+		tree.stats.enter()
+		defer tree.stats.leave()
+	}
+	if tree.compare(key, h.Key()) < 0 {
 		if !isRed(h.Left()) && h.Left() != nil && !isRed(h.Left().Left()) {
 			h = tree.moveRedLeft(h)
 		}
-		trace.Trace("h is %v", h)
-		h.SetLeft(tree.delete(h.Left(), key))
+		tree.setLeft(h, tree.delete(h.Left(), key))
 	} else {
-		trace.Trace("h is %v", h)
 		// NOTE this is a deviation here, because the 2nd condition is
 		// not in the LLRB paper; the rationale is that we only
 		// want to rotate right if there is 1 black child, but not
@@ -207,92 +350,293 @@ func (tree *llrb) delete(h Node, key Key) Node {
 		if isRed(h.Left()) && !isRed(h.Right()) {
 			h = tree.rotateRight(h)
 		}
-		trace.Trace("h is %v", h)
-		if key.Compare(h.Key()) == 0 && h.Right() == nil {
+		if tree.compare(key, h.Key()) == 0 && h.Right() == nil {
+			tree.traceNode(TraceDelete, h)
 			return nil
 		}
-		trace.Trace("h is %v", h)
 		if !isRed(h.Right()) && h.Right() != nil && !isRed(h.Right().Left()) {
 			h = tree.moveRedRight(h)
 		}
-		trace.Trace("h is %v", h)
-		if key.Compare(h.Key()) == 0 {
-			trace.Trace("Key %v == {%v}", key, h.Key())
+		if tree.compare(key, h.Key()) == 0 {
+			tree.traceNode(TraceDelete, h)
 			minRight := h.Right().min()
 			h.SetValue(tree.search(h.Right(), minRight))
 			h.SetKey(minRight)
-			h.SetRight(tree.deleteMin(h.Right()))
-			trace.Trace("After deleting key %v, node is %v and tree is\n%v", key, h, tree)
+			tree.setRight(h, tree.deleteMin(h.Right()))
 		} else {
-			h.SetRight(tree.delete(h.Right(), key))
-			trace.Trace("After deleting from right key %v, node is %v and tree is\n%v", key, h, tree)
+			tree.setRight(h, tree.delete(h.Right(), key))
 		}
 	}
 	h = tree.fixUp(h)
-	trace.Trace("Returning from delete %v", h)
 	return h
 }
 
 func (tree *llrb) deleteMin(h Node) Node {
-	trace.Trace("Before deleting min from %v\n%v", h, tree)
+	if tree.stats != nil {
+		tree.stats.enter()
+		defer tree.stats.leave()
+	}
 	if h.Left() == nil {
 		return nil
 	}
+	h = tree.own(h)
 	if !isRed(h.Left()) && !isRed(h.Left().Left()) {
 		h = tree.moveRedLeft(h)
 	}
-	h.SetLeft(tree.deleteMin(h.Left()))
-	trace.Trace("After deleting min from %v\n%v", h, tree)
+	tree.setLeft(h, tree.deleteMin(h.Left()))
 	return tree.fixUp(h)
 }
 
+func (tree *llrb) deleteMax(h Node) Node {
+	if tree.stats != nil {
+		tree.stats.enter()
+		defer tree.stats.leave()
+	}
+	if isRed(h.Left()) && !isRed(h.Right()) {
+		h = tree.rotateRight(h)
+	}
+	if h.Right() == nil {
+		return nil
+	}
+	h = tree.own(h)
+	if !isRed(h.Right()) && !isRed(h.Right().Left()) {
+		h = tree.moveRedRight(h)
+	}
+	tree.setRight(h, tree.deleteMax(h.Right()))
+	return tree.fixUp(h)
+}
+
+/*
+Split the tree rooted at h into two trees: one holding the keys less than key
+(or equal to it, if inclusive), and one holding the rest. Both returned trees
+have black roots, and the nodes of h are reused to build them.
+*/
+func (tree *llrb) split(h Node, key Key, inclusive bool) (Node, Node) {
+	if h == nil {
+		return nil, nil
+	}
+	if tree.stats != nil {
+		tree.stats.enter()
+		defer tree.stats.leave()
+	}
+	h = tree.own(h)
+	left, right := h.Left(), h.Right()
+	cmp := tree.compare(key, h.Key())
+	if cmp < 0 || (cmp == 0 && !inclusive) {
+		l, r := tree.split(left, key, inclusive)
+		return l, tree.join(r, h, tree.blacken(right))
+	}
+	l, r := tree.split(right, key, inclusive)
+	return tree.join(tree.blacken(left), h, l), r
+}
+
+/*
+Join two trees with black roots, l and r, using m as the node between them;
+all keys in l must be less than m's key, and all keys in r greater
+*/
+func (tree *llrb) join(l, m, r Node) Node {
+	lh, rh := blackHeight(l), blackHeight(r)
+	var h Node
+	if lh >= rh {
+		h = tree.joinRight(l, lh, m, r, rh)
+	} else {
+		h = tree.joinLeft(l, lh, m, r, rh)
+	}
+	h.SetColor(BLACK)
+	return h
+}
+
+func (tree *llrb) joinRight(h Node, hh int, m, r Node, rh int) Node {
+	if hh == rh && !isRed(h) {
+		tree.setLeft(m, h)
+		tree.setRight(m, r)
+		m.SetColor(RED)
+		return m
+	}
+	if !isRed(h) {
+		hh--
+	}
+	h = tree.own(h)
+	tree.setRight(h, tree.joinRight(h.Right(), hh, m, r, rh))
+	return tree.fixUp(h)
+}
+
+func (tree *llrb) joinLeft(l Node, lh int, m, h Node, hh int) Node {
+	if hh == lh && !isRed(h) {
+		tree.setLeft(m, l)
+		tree.setRight(m, h)
+		m.SetColor(RED)
+		return m
+	}
+	if !isRed(h) {
+		hh--
+	}
+	h = tree.own(h)
+	tree.setLeft(h, tree.joinLeft(l, lh, m, h.Left(), hh))
+	return tree.fixUp(h)
+}
+
+/*
+Join two trees with black roots, where all keys in l are less than all
+keys in r
+*/
+func (tree *llrb) concat(l, r Node) Node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	m := r
+	for m.Left() != nil {
+		m = m.Left()
+	}
+	m = tree.own(m)
+	r = blacken(tree.deleteMin(r))
+	return tree.join(l, m, r)
+}
+
+func (tree *llrb) compare(key1, key2 Key) int {
+	if tree.stats != nil {
+		tree.stats.comparisons.Add(1)
+	}
+	return key1.Compare(key2)
+}
+
+func (tree *llrb) trace(event TraceEvent, key Key) {
+	if tree.tracer != nil {
+		tree.tracer.Trace(event, key)
+	}
+}
+
+func (tree *llrb) traceNode(event TraceEvent, h Node) {
+	if tree.tracer != nil {
+		tree.tracer.Trace(event, h.Key())
+	}
+}
+
+/*
+Trace the deletion of every key from low to high, inclusive, under h in
+order; comparisons are not counted in statistics, as they are only made
+while tracing
+*/
+func (tree *llrb) traceRange(h Node, low, high Key) {
+	if h == nil {
+		return
+	}
+	if low.Compare(h.Key()) < 0 {
+		tree.traceRange(h.Left(), low, high)
+	}
+	if low.Compare(h.Key()) <= 0 && high.Compare(h.Key()) >= 0 {
+		tree.tracer.Trace(TraceDelete, h.Key())
+	}
+	if high.Compare(h.Key()) > 0 {
+		tree.traceRange(h.Right(), low, high)
+	}
+}
+
+func (tree *llrb) setLeft(h, l Node) {
+	h.SetLeft(l)
+	tree.augment(h)
+}
+
+func (tree *llrb) setRight(h, r Node) {
+	h.SetRight(r)
+	tree.augment(h)
+}
+
+/*
+Recompute the aggregate held by h, if the tree is augmented, and its hash,
+if it is a Merkle tree; the aggregates and hashes of h's children must
+already be up to date
+*/
+func (tree *llrb) augment(h Node) {
+	if hashed, ok := h.(*node).NodeImpl.(MerkleNodeImpl); ok {
+		hashed.SetHash(mustHashEntry(h.Key(), h.Value(), merkleHash(h.Left()), merkleHash(h.Right())))
+	}
+	if tree.monoid == nil {
+		return
+	}
+	m := tree.monoid
+	a := m.Combine(aggregate(h.Left(), m), m.Measure(h.Key(), h.Value()))
+	h.(*node).NodeImpl.(AugmentedNodeImpl).SetAggregate(m.Combine(a, aggregate(h.Right(), m)))
+}
+
+func (tree *llrb) flipColors(h Node) {
+	tree.traceNode(TraceFlip, h)
+	tree.ownChildren(h)
+	if tree.stats != nil {
+		tree.stats.colorFlips.Add(1)
+	}
+	h.flipColors()
+}
+
 func (tree *llrb) rotateLeft(h Node) Node {
-	trace.Trace("Before rotate left of %v\n%v", h, tree)
-	x := h.Right()
-	h.SetRight(x.Left())
-	x.SetLeft(h)
+	tree.traceNode(TraceRotateLeft, h)
+	if tree.stats != nil {
+		tree.stats.rotateLefts.Add(1)
+	}
+	h = tree.own(h)
+	x := tree.own(h.Right())
+	tree.setRight(h, x.Left())
+	tree.setLeft(x, h)
 	x.SetColor(h.Color())
 	h.SetColor(RED)
-	trace.Trace("After rotate left of %v, returning {%v}\n%v", h, x.Key(), tree)
 	return x
 }
 
 func (tree *llrb) rotateRight(h Node) Node {
-	trace.Trace("Before rotate right of %v\n%v", h, tree)
-	x := h.Left()
-	h.SetLeft(x.Right())
-	x.SetRight(h)
+	tree.traceNode(TraceRotateRight, h)
+	if tree.stats != nil {
+		tree.stats.rotateRights.Add(1)
+	}
+	h = tree.own(h)
+	x := tree.own(h.Left())
+	tree.setLeft(h, x.Right())
+	tree.setRight(x, h)
 	x.SetColor(h.Color())
 	h.SetColor(RED)
-	trace.Trace("After rotate right of %v, returning {%v}\n%v", h, x.Key(), tree)
 	return x
 }
 
 func (tree *llrb) moveRedLeft(h Node) Node {
-	trace.Trace("Before move red left of %v\n%v", h, tree)
-	h.flipColors()
+	if tree.stats != nil {
+		tree.stats.moveRedLefts.Add(1)
+	}
+	h = tree.own(h)
+	tree.flipColors(h)
 	if isRed(h.Right().Left()) {
-		h.SetRight(tree.rotateRight(h.Right()))
+		tree.setRight(h, tree.rotateRight(h.Right()))
 		h = tree.rotateLeft(h)
-		h.flipColors()
+		tree.flipColors(h)
 	}
-	trace.Trace("After move red left of %v\n%v", h, tree)
 	return h
 }
 
 func (tree *llrb) moveRedRight(h Node) Node {
-	trace.Trace("Before move red right of %v\n%v", h, tree)
-	h.flipColors()
+	if tree.stats != nil {
+		tree.stats.moveRedRights.Add(1)
+	}
+	h = tree.own(h)
+	tree.flipColors(h)
 	if isRed(h.Left().Left()) {
 		h = tree.rotateRight(h)
-		h.flipColors()
+		tree.flipColors(h)
 	}
-	trace.Trace("After move red right of %v\n%v", h, tree)
 	return h
 }
 
 func (tree *llrb) fixUp(h Node) Node {
-	trace.Trace("Before fix up of %v\n%v", h, tree)
+	h = tree.own(h)
+	// NOTE these first and last steps are not in the LLRB paper; insert
+	// leaves 4-nodes in the tree (a node with 2 red children), and when
+	// delete passes through one it can hand back a red right child that
+	// itself has a red child, or leave a right-leaning red link beside
+	// the path it followed.  Neither happens in a 2-3 tree, which is
+	// what the paper's delete assumes.
+	if isRed(h.Right()) && isRed(h.Right().Left()) {
+		tree.setRight(h, tree.rotateRight(h.Right()))
+	}
 	if isRed(h.Right()) && !isRed(h.Left()) {
 		h = tree.rotateLeft(h)
 	}
@@ -300,9 +644,11 @@ func (tree *llrb) fixUp(h Node) Node {
 		h = tree.rotateRight(h)
 	}
 	if isRed(h.Left()) && isRed(h.Right()) {
-		h.flipColors()
+		tree.flipColors(h)
+	}
+	if r := h.Right(); r != nil && !isRed(r) && isRed(r.Right()) && !isRed(r.Left()) {
+		tree.setRight(h, tree.rotateLeft(r))
 	}
-	trace.Trace("After fix up of %v\n%v", h, tree)
 	return h
 }
 
@@ -401,6 +747,7 @@ type NodeImpl interface {
 
 type node struct {
 	NodeImpl
+	owner *owner
 }
 
 func isRed(h Node) bool {
@@ -410,6 +757,62 @@ func isRed(h Node) bool {
 	return h.Color() == RED
 }
 
+func blacken(h Node) Node {
+	if h != nil {
+		h.SetColor(BLACK)
+	}
+	return h
+}
+
+/*
+Return the number of black nodes on any path from h to a leaf
+*/
+func blackHeight(h Node) int {
+	height := 0
+	for ; h != nil; h = h.Left() {
+		if !isRed(h) {
+			height++
+		}
+	}
+	return height
+}
+
+/*
+Visit every node under h in key order
+*/
+func walk(h Node, visit func(h Node)) {
+	for h != nil {
+		walk(h.Left(), visit)
+		visit(h)
+		h = h.Right()
+	}
+}
+
+/*
+Visit every node under h with a key not less than low and less than high in
+key order, where a nil bound is unbounded
+*/
+func walkRange(h Node, low, high Key, visit func(h Node)) {
+	for h != nil {
+		if high != nil && h.Key().Compare(high) >= 0 {
+			h = h.Left()
+			continue
+		}
+		if low == nil || h.Key().Compare(low) >= 0 {
+			walkRange(h.Left(), low, high, visit)
+			visit(h)
+		}
+		h = h.Right()
+	}
+}
+
+func size(h Node) int {
+	if h != nil {
+		return 1 + size(h.Left()) + size(h.Right())
+	}
+	return 0
+}
+
 func (h *node) flipColors() {
 	h.SetColor(!h.Color())
 	h.Left().SetColor(!h.Left().Color())
@@ -0,0 +1,283 @@
+/*
+Tests that any implementation of redblack.LLRBImpl must pass.  To check a
+custom implementation, call RunConformance from one of its tests:
+
+	func TestConformance(t *testing.T) {
+		redblacktest.RunConformance(t, func() redblack.LLRBImpl {
+			return NewMyLLRBImpl()
+		})
+	}
+*/
+package redblacktest
+
+import "fmt"
+import "math/rand"
+import "sort"
+import "testing"
+
+import "github.com/hargettp/go-rb/redblack"
+
+/*
+Run the conformance tests against empty trees created by newImpl, which must
+return a new, empty implementation each time it is called
+*/
+func RunConformance(t *testing.T, newImpl func() redblack.LLRBImpl) {
+	newTree := func() redblack.LLRB {
+		return redblack.NewRedBlackTree(newImpl())
+	}
+	t.Run("Empty", func(t *testing.T) { testEmpty(t, newTree()) })
+	t.Run("InsertAscending", func(t *testing.T) { testInserts(t, newTree(), ascending(100)) })
+	t.Run("InsertDescending", func(t *testing.T) { testInserts(t, newTree(), descending(100)) })
+	t.Run("InsertShuffled", func(t *testing.T) { testInserts(t, newTree(), shuffled(100, 1)) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, newTree()) })
+	t.Run("Delete", func(t *testing.T) { testDeletes(t, newTree) })
+	t.Run("DeleteMissing", func(t *testing.T) { testDeleteMissing(t, newTree()) })
+	t.Run("DeleteRange", func(t *testing.T) { testDeleteRanges(t, newTree) })
+	t.Run("PopMinMax", func(t *testing.T) { testPops(t, newTree()) })
+	t.Run("Random", func(t *testing.T) { testRandom(t, newTree) })
+	t.Run("Clone", func(t *testing.T) { testClone(t, newTree()) })
+}
+
+func testEmpty(t *testing.T, tree redblack.LLRB) {
+	if tree.Size() != 0 || tree.Root() != nil {
+		t.Fatalf("new tree is not empty: size %v", tree.Size())
+	}
+	if value := tree.Search(redblack.IntKey(1)); value != nil {
+		t.Errorf("empty tree has value %v for key 1", value)
+	}
+	tree.Delete(redblack.IntKey(1))
+	tree.DeleteMin()
+	tree.DeleteMax()
+	if removed := tree.DeleteRange(redblack.IntKey(0), redblack.IntKey(10)); removed != 0 {
+		t.Errorf("deleting range from empty tree removed %v keys", removed)
+	}
+	check(t, tree, map[int]string{})
+}
+
+func testInserts(t *testing.T, tree redblack.LLRB, keys []int) {
+	expected := make(map[int]string)
+	for _, k := range keys {
+		expected[k] = value(k)
+		tree.Insert(redblack.IntKey(k), redblack.StringValue(value(k)))
+		check(t, tree, expected)
+	}
+	checkOrder(t, tree, expected)
+}
+
+func testOverwrite(t *testing.T, tree redblack.LLRB) {
+	expected := make(map[int]string)
+	for _, k := range ascending(20) {
+		expected[k] = value(k)
+		tree.Insert(redblack.IntKey(k), redblack.StringValue(value(k)))
+	}
+	for _, k := range shuffled(20, 2) {
+		expected[k] = "new " + value(k)
+		tree.Insert(redblack.IntKey(k), redblack.StringValue(expected[k]))
+		check(t, tree, expected)
+	}
+}
+
+func testDeletes(t *testing.T, newTree func() redblack.LLRB) {
+	for _, k := range ascending(50) {
+		tree, expected := fill(newTree(), ascending(50))
+		tree.Delete(redblack.IntKey(k))
+		delete(expected, k)
+		check(t, tree, expected)
+	}
+	tree, expected := fill(newTree(), shuffled(100, 3))
+	for _, k := range shuffled(100, 4) {
+		tree.Delete(redblack.IntKey(k))
+		delete(expected, k)
+		check(t, tree, expected)
+	}
+}
+
+func testDeleteMissing(t *testing.T, tree redblack.LLRB) {
+	tree, expected := fill(tree, ascending(50))
+	for _, k := range []int{-1, 0, 51, 100} {
+		tree.Delete(redblack.IntKey(k))
+		check(t, tree, expected)
+	}
+	for _, k := range ascending(50) {
+		tree.Delete(redblack.IntKey(k))
+		delete(expected, k)
+		tree.Delete(redblack.IntKey(k))
+		check(t, tree, expected)
+	}
+}
+
+func testDeleteRanges(t *testing.T, newTree func() redblack.LLRB) {
+	for _, r := range [][2]int{{1, 1}, {1, 25}, {10, 40}, {26, 50}, {0, 100}, {60, 70}, {30, 20}} {
+		tree, expected := fill(newTree(), shuffled(50, 5))
+		removed := tree.DeleteRange(redblack.IntKey(r[0]), redblack.IntKey(r[1]))
+		count := 0
+		for k := range expected {
+			if k >= r[0] && k <= r[1] {
+				delete(expected, k)
+				count++
+			}
+		}
+		if removed != count {
+			t.Errorf("deleting range %v-%v removed %v keys, expected %v", r[0], r[1], removed, count)
+		}
+		check(t, tree, expected)
+	}
+}
+
+func testPops(t *testing.T, tree redblack.LLRB) {
+	tree, expected := fill(tree, shuffled(50, 6))
+	for low, high := 1, 50; low < high; low, high = low+1, high-1 {
+		if key, value := tree.PopMin(); key != redblack.IntKey(low) || value.String() != expected[low] {
+			t.Errorf("expected to pop min %v, popped %v=%v", low, key, value)
+		}
+		if key, value := tree.PopMax(); key != redblack.IntKey(high) || value.String() != expected[high] {
+			t.Errorf("expected to pop max %v, popped %v=%v", high, key, value)
+		}
+		delete(expected, low)
+		delete(expected, high)
+		check(t, tree, expected)
+	}
+	if key, value := tree.PopMin(); key != nil || value != nil {
+		t.Errorf("expected nothing to pop from empty tree, popped %v=%v", key, value)
+	}
+}
+
+func testRandom(t *testing.T, newTree func() redblack.LLRB) {
+	random := rand.New(rand.NewSource(7))
+	for round := 0; round < 20; round++ {
+		tree := newTree()
+		expected := make(map[int]string)
+		for op := 0; op < 500; op++ {
+			k := random.Intn(200)
+			switch random.Intn(8) {
+			case 0, 1:
+				tree.Delete(redblack.IntKey(k))
+				delete(expected, k)
+			case 2:
+				high := k + random.Intn(10)
+				tree.DeleteRange(redblack.IntKey(k), redblack.IntKey(high))
+				for i := k; i <= high; i++ {
+					delete(expected, i)
+				}
+			case 3:
+				if key, _ := tree.PopMin(); key != nil {
+					delete(expected, int(key.(redblack.IntKey)))
+				}
+			case 4:
+				if key, _ := tree.PopMax(); key != nil {
+					delete(expected, int(key.(redblack.IntKey)))
+				}
+			default:
+				expected[k] = fmt.Sprintf("%v@%v", k, op)
+				tree.Insert(redblack.IntKey(k), redblack.StringValue(expected[k]))
+			}
+			check(t, tree, expected)
+			if t.Failed() {
+				t.Fatalf("failed in round %v after operation %v on key %v", round, op, k)
+			}
+		}
+		checkOrder(t, tree, expected)
+	}
+}
+
+func testClone(t *testing.T, tree redblack.LLRB) {
+	tree, expected := fill(tree, shuffled(100, 8))
+	clone := tree.Clone()
+	cloned := make(map[int]string)
+	for k, v := range expected {
+		cloned[k] = v
+	}
+	for _, k := range shuffled(100, 9)[:50] {
+		clone.Delete(redblack.IntKey(k))
+		delete(cloned, k)
+		tree.Insert(redblack.IntKey(k), redblack.StringValue("new "+value(k)))
+		expected[k] = "new " + value(k)
+		check(t, tree, expected)
+		check(t, clone, cloned)
+	}
+	checkOrder(t, clone, cloned)
+	check(t, tree, expected)
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+/*
+Check that the tree holds exactly the expected keys and values, and satisfies
+all red-black invariants
+*/
+func check(t *testing.T, tree redblack.LLRB, expected map[int]string) {
+	t.Helper()
+	if err := redblack.Verify(tree); err != nil {
+		t.Fatalf("%v\n%v", err, tree)
+	}
+	if tree.Size() != len(expected) {
+		t.Fatalf("expected %v keys, tree has %v", len(expected), tree.Size())
+	}
+	if shape := tree.Shape(); !shape.Balanced() {
+		t.Fatalf("expected height at most %v, tree has %v", shape.MaxHeight(), shape.Height)
+	}
+	for k, v := range expected {
+		if found := tree.Search(redblack.IntKey(k)); found == nil || found.String() != v {
+			t.Fatalf("expected value %v for key %v, found %v", v, k, found)
+		}
+	}
+}
+
+/*
+Check that popping every key from the tree yields the expected keys in order
+*/
+func checkOrder(t *testing.T, tree redblack.LLRB, expected map[int]string) {
+	t.Helper()
+	keys := make([]int, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		if key, _ := tree.PopMin(); key != redblack.IntKey(k) {
+			t.Fatalf("expected to pop key %v, popped %v", k, key)
+		}
+	}
+	if tree.Size() != 0 {
+		t.Fatalf("expected empty tree after popping all keys, %v remain", tree.Size())
+	}
+}
+
+func fill(tree redblack.LLRB, keys []int) (redblack.LLRB, map[int]string) {
+	expected := make(map[int]string)
+	for _, k := range keys {
+		expected[k] = value(k)
+		tree.Insert(redblack.IntKey(k), redblack.StringValue(value(k)))
+	}
+	return tree, expected
+}
+
+func value(k int) string {
+	return fmt.Sprintf("value %v", k)
+}
+
+func ascending(n int) []int {
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = i + 1
+	}
+	return keys
+}
+
+func descending(n int) []int {
+	keys := ascending(n)
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	return keys
+}
+
+func shuffled(n int, seed int64) []int {
+	keys := ascending(n)
+	rand.New(rand.NewSource(seed)).Shuffle(n, func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	return keys
+}
@@ -0,0 +1,24 @@
+package redblacktest
+
+import "testing"
+
+import "github.com/hargettp/go-rb/redblack"
+
+func TestMemoryConformance(t *testing.T) {
+	RunConformance(t, func() redblack.LLRBImpl {
+		return redblack.NewMemoryLLRBImpl()
+	})
+}
+
+func TestUncloneableConformance(t *testing.T) {
+	RunConformance(t, func() redblack.LLRBImpl {
+		return uncloneableImpl{redblack.NewMemoryLLRBImpl()}
+	})
+}
+
+/*
+Hides NewLLRBImpl, so trees using it must be cloned by copying
+*/
+type uncloneableImpl struct {
+	redblack.LLRBImpl
+}
@@ -0,0 +1,281 @@
+package redblack
+
+import "strings"
+
+//=============================================================================
+//
+// Sets
+//
+//=============================================================================
+
+/*
+An ordered set of keys, kept in a red-black tree whose nodes hold no values
+*/
+type Set interface {
+	/*
+		Add key to the set, if not already present
+	*/
+	Add(key Key)
+	/*
+		Remove key from the set, if present
+	*/
+	Remove(key Key)
+	/*
+		Return true if key is in the set
+	*/
+	Has(key Key) bool
+	/*
+		Return the number of keys in the set
+	*/
+	Size() int
+	/*
+		Return the smallest key in the set, or nil if the set is empty
+	*/
+	Min() Key
+	/*
+		Return the largest key in the set, or nil if the set is empty
+	*/
+	Max() Key
+	/*
+		Call visit with each key in the set in order, stopping early if
+		visit returns false
+	*/
+	Each(visit func(key Key) bool)
+	/*
+		Return the keys in the set in order
+	*/
+	Keys() []Key
+	/*
+		Return a new set holding the same keys, sharing storage with this
+		set until either changes
+	*/
+	Clone() Set
+	/*
+		Return a new set holding the keys in either this set or other
+	*/
+	Union(other Set) Set
+	/*
+		Return a new set holding the keys in both this set and other
+	*/
+	Intersection(other Set) Set
+	/*
+		Return a new set holding the keys in this set but not in other
+	*/
+	Difference(other Set) Set
+	String() string
+}
+
+type set struct {
+	tree LLRB
+}
+
+/*
+Create a new, empty set
+*/
+func NewSet() Set {
+	return &set{NewRedBlackTree(&setLLRB{})}
+}
+
+/*
+Create a new set holding the provided keys
+*/
+func NewSetOf(keys ...Key) Set {
+	s := NewSet()
+	for _, key := range keys {
+		s.Add(key)
+	}
+	return s
+}
+
+func (s *set) Add(key Key) {
+	s.tree.Insert(key, nil)
+}
+
+func (s *set) Remove(key Key) {
+	s.tree.Delete(key)
+}
+
+func (s *set) Has(key Key) bool {
+	for h := s.tree.Root(); h != nil; {
+		cmp := key.Compare(h.Key())
+		if cmp == 0 {
+			return true
+		} else if cmp < 0 {
+			h = h.Left()
+		} else {
+			h = h.Right()
+		}
+	}
+	return false
+}
+
+func (s *set) Size() int {
+	return s.tree.Size()
+}
+
+func (s *set) Min() Key {
+	if s.tree.Root() == nil {
+		return nil
+	}
+	return s.tree.Root().min()
+}
+
+func (s *set) Max() Key {
+	if s.tree.Root() == nil {
+		return nil
+	}
+	return s.tree.Root().max()
+}
+
+func (s *set) Each(visit func(key Key) bool) {
+	var each func(h Node) bool
+	each = func(h Node) bool {
+		for ; h != nil; h = h.Right() {
+			if !each(h.Left()) || !visit(h.Key()) {
+				return false
+			}
+		}
+		return true
+	}
+	each(s.tree.Root())
+}
+
+func (s *set) Keys() []Key {
+	keys := make([]Key, 0, s.Size())
+	s.Each(func(key Key) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (s *set) Clone() Set {
+	return &set{s.tree.Clone()}
+}
+
+func (s *set) Union(other Set) Set {
+	return merge(s.Keys(), other.Keys(), true, true, true)
+}
+
+func (s *set) Intersection(other Set) Set {
+	return merge(s.Keys(), other.Keys(), false, true, false)
+}
+
+func (s *set) Difference(other Set) Set {
+	return merge(s.Keys(), other.Keys(), true, false, false)
+}
+
+func (s *set) String() string {
+	keys := make([]string, 0, s.Size())
+	s.Each(func(key Key) bool {
+		keys = append(keys, key.String())
+		return true
+	})
+	return "{" + strings.Join(keys, " ") + "}"
+}
+
+/*
+Merge two ordered lists of keys into a new set, keeping the keys only in a,
+in both, or only in b as requested
+*/
+func merge(a, b []Key, onlyA, both, onlyB bool) Set {
+	result := NewSet()
+	for len(a) > 0 || len(b) > 0 {
+		cmp := 0
+		switch {
+		case len(a) == 0:
+			cmp = 1
+		case len(b) == 0:
+			cmp = -1
+		default:
+			cmp = a[0].Compare(b[0])
+		}
+		switch {
+		case cmp < 0:
+			if onlyA {
+				result.Add(a[0])
+			}
+			a = a[1:]
+		case cmp > 0:
+			if onlyB {
+				result.Add(b[0])
+			}
+			b = b[1:]
+		default:
+			if both {
+				result.Add(a[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+	}
+	return result
+}
+
+//
+// Set implementation, with nodes that hold no value
+//
+
+type setLLRB struct {
+	root Node
+}
+
+type setNode struct {
+	key         Key
+	left, right Node
+	color       Color
+}
+
+func (tree *setLLRB) NewNodeImpl(key Key, value Value) NodeImpl {
+	return &setNode{key: key, color: RED}
+}
+
+func (tree *setLLRB) NewLLRBImpl() LLRBImpl {
+	return &setLLRB{}
+}
+
+func (tree *setLLRB) Root() Node {
+	return tree.root
+}
+
+func (tree *setLLRB) SetRoot(root Node) {
+	tree.root = root
+}
+
+func (h *setNode) Key() Key {
+	return h.key
+}
+
+func (h *setNode) SetKey(key Key) {
+	h.key = key
+}
+
+func (h *setNode) Value() Value {
+	return nil
+}
+
+func (h *setNode) SetValue(value Value) {
+}
+
+func (h *setNode) Left() Node {
+	return h.left
+}
+
+func (h *setNode) SetLeft(l Node) {
+	h.left = l
+}
+
+func (h *setNode) Right() Node {
+	return h.right
+}
+
+func (h *setNode) SetRight(r Node) {
+	h.right = r
+}
+
+func (h *setNode) Color() Color {
+	return h.color
+}
+
+func (h *setNode) SetColor(c Color) {
+	h.color = c
+}
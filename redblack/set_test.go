@@ -0,0 +1,83 @@
+package redblack
+
+import "fmt"
+import "testing"
+
+func TestSet(t *testing.T) {
+	s := NewSet()
+	if s.Size() != 0 || s.Min() != nil || s.Max() != nil || s.Has(IntKey(1)) {
+		log.Error("Expected empty set, saw %v", s)
+		t.Fail()
+	}
+	for _, k := range []int{5, 3, 8, 1, 3, 9, 5} {
+		s.Add(IntKey(k))
+	}
+	if s.String() != "{1 3 5 8 9}" || s.Size() != 5 {
+		log.Error("Expected set {1 3 5 8 9}, saw %v with size %v", s, s.Size())
+		t.Fail()
+	}
+	if s.Min() != IntKey(1) || s.Max() != IntKey(9) {
+		log.Error("Expected min 1 and max 9, saw %v and %v", s.Min(), s.Max())
+		t.Fail()
+	}
+	if !s.Has(IntKey(8)) || s.Has(IntKey(7)) {
+		log.Error("Expected set to have 8 but not 7")
+		t.Fail()
+	}
+	s.Remove(IntKey(3))
+	s.Remove(IntKey(4))
+	if fmt.Sprint(s.Keys()) != "[1 5 8 9]" {
+		log.Error("Expected keys [1 5 8 9] after removing 3, saw %v", s.Keys())
+		t.Fail()
+	}
+	visited := make([]Key, 0)
+	s.Each(func(key Key) bool {
+		visited = append(visited, key)
+		return key.Compare(IntKey(5)) < 0
+	})
+	if fmt.Sprint(visited) != "[1 5]" {
+		log.Error("Expected iteration to stop after 5, saw %v", visited)
+		t.Fail()
+	}
+}
+
+func TestSetBalance(t *testing.T) {
+	s := NewSet()
+	for i := 0; i < 200; i++ {
+		s.Add(IntKey((i * 7) % 200))
+	}
+	for i := 0; i < 200; i += 3 {
+		s.Remove(IntKey(i))
+	}
+	tree := s.(*set).tree
+	if !checkBalance(tree) || tree.Size() != 133 {
+		log.Error("Expected balanced set of 133 keys, saw %v", tree.Size())
+		t.Fail()
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := NewSetOf(IntKey(1), IntKey(2), IntKey(3), IntKey(5), IntKey(8))
+	b := NewSetOf(IntKey(2), IntKey(4), IntKey(8), IntKey(16))
+	for _, check := range []struct {
+		name     string
+		result   Set
+		expected string
+	}{
+		{"union", a.Union(b), "{1 2 3 4 5 8 16}"},
+		{"intersection", a.Intersection(b), "{2 8}"},
+		{"difference", a.Difference(b), "{1 3 5}"},
+		{"reverse difference", b.Difference(a), "{4 16}"},
+		{"union with empty", a.Union(NewSet()), "{1 2 3 5 8}"},
+		{"intersection with empty", a.Intersection(NewSet()), "{}"},
+	} {
+		if check.result.String() != check.expected {
+			log.Error("Expected %v %v, saw %v", check.name, check.expected, check.result)
+			t.Fail()
+		}
+	}
+	if a.String() != "{1 2 3 5 8}" || b.String() != "{2 4 8 16}" {
+		log.Error("Expected operands to be unchanged, saw %v and %v", a, b)
+		t.Fail()
+	}
+}
@@ -0,0 +1,104 @@
+package redblack
+
+import "math"
+
+//=============================================================================
+//
+// Shape
+//
+//=============================================================================
+
+/*
+A summary of the shape of a tree, for diagnosing balance problems.  Depths
+count nodes along a path, so the root is at depth 1.
+*/
+type Shape struct {
+	/*
+		Number of nodes in the tree
+	*/
+	Size int
+	/*
+		Depth of the deepest node, which is the length of the longest path
+		from the root
+	*/
+	Height int
+	/*
+		Number of black nodes on the path from the root to the smallest key
+	*/
+	BlackHeight int
+	/*
+		Mean depth of all nodes in the tree, or 0 if the tree is empty
+	*/
+	AveragePathLength float64
+	/*
+		Number of nodes at each depth: Depths[0] counts the root, Depths[1]
+		its children, and so on
+	*/
+	Depths []int
+}
+
+/*
+Return the greatest height a tree of this size may have if balanced, which
+is 2·log2(n) rounded up (and 1 for a single node)
+*/
+func (shape Shape) MaxHeight() int {
+	switch shape.Size {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	}
+	return 2 * int(math.Ceil(math.Log2(float64(shape.Size))))
+}
+
+/*
+Return true if the height of the tree is within the bound given by MaxHeight
+*/
+func (shape Shape) Balanced() bool {
+	return shape.Height <= shape.MaxHeight()
+}
+
+func (tree *llrb) Height() int {
+	return height(tree.Root())
+}
+
+func (tree *llrb) BlackHeight() int {
+	return blackHeight(tree.Root())
+}
+
+func (tree *llrb) Shape() Shape {
+	shape := Shape{Depths: make([]int, 0)}
+	total := 0
+	var visit func(h Node, depth int)
+	visit = func(h Node, depth int) {
+		if h == nil {
+			return
+		}
+		if depth > shape.Height {
+			shape.Height = depth
+			shape.Depths = append(shape.Depths, 0)
+		}
+		shape.Depths[depth-1]++
+		shape.Size++
+		total += depth
+		visit(h.Left(), depth+1)
+		visit(h.Right(), depth+1)
+	}
+	visit(tree.Root(), 1)
+	shape.BlackHeight = blackHeight(tree.Root())
+	if shape.Size > 0 {
+		shape.AveragePathLength = float64(total) / float64(shape.Size)
+	}
+	return shape
+}
+
+func height(h Node) int {
+	if h == nil {
+		return 0
+	}
+	l, r := height(h.Left()), height(h.Right())
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
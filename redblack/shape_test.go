@@ -0,0 +1,80 @@
+package redblack
+
+import "fmt"
+import "testing"
+
+func TestShape(t *testing.T) {
+	tree := NewLLRB()
+	if shape := tree.Shape(); shape.Size != 0 || shape.Height != 0 || len(shape.Depths) != 0 || !shape.Balanced() {
+		log.Error("Unexpected shape for empty tree: %+v", shape)
+		t.Fail()
+	}
+	for i := 1; i <= 7; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	shape := tree.Shape()
+	if shape.Size != 7 || shape.Height != 3 || shape.BlackHeight != 2 {
+		log.Error("Expected size 7, height 3 and black height 2, saw %+v", shape)
+		t.Fail()
+	}
+	if tree.Height() != shape.Height || tree.BlackHeight() != shape.BlackHeight {
+		log.Error("Expected Height %v and BlackHeight %v, saw %v and %v",
+			shape.Height, shape.BlackHeight, tree.Height(), tree.BlackHeight())
+		t.Fail()
+	}
+	if fmt.Sprint(shape.Depths) != "[1 2 4]" {
+		log.Error("Expected depths [1 2 4], saw %v", shape.Depths)
+		t.Fail()
+	}
+	if shape.AveragePathLength != 17.0/7.0 {
+		log.Error("Expected average path length %v, saw %v", 17.0/7.0, shape.AveragePathLength)
+		t.Fail()
+	}
+	if shape.MaxHeight() != 6 || !shape.Balanced() {
+		log.Error("Expected balanced tree with max height 6, saw %+v", shape)
+		t.Fail()
+	}
+}
+
+func TestShapeLarge(t *testing.T) {
+	lots := 1000
+	tree := NewLLRB()
+	for i := 0; i < lots; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	shape := tree.Shape()
+	if !shape.Balanced() || shape.Size != lots {
+		log.Error("Expected balanced tree of %v keys, saw %+v", lots, shape)
+		t.Fail()
+	}
+	total := 0
+	for _, count := range shape.Depths {
+		total += count
+	}
+	if total != lots || len(shape.Depths) != shape.Height {
+		log.Error("Depth histogram %v does not match size %v and height %v", shape.Depths, lots, shape.Height)
+		t.Fail()
+	}
+}
+
+func TestShapeUnbalanced(t *testing.T) {
+	// link nodes directly into a chain, as a buggy implementation might
+	tree := NewLLRB()
+	var root Node
+	for i := 8; i >= 1; i-- {
+		h := tree.NewNode(IntKey(i), StringValue(IntKey(i).String()))
+		h.SetColor(BLACK)
+		h.SetRight(root)
+		root = h
+	}
+	tree.SetRoot(root)
+	shape := tree.Shape()
+	if shape.Height != 8 || shape.MaxHeight() != 6 || shape.Balanced() {
+		log.Error("Expected unbalanced tree of height 8, saw %+v", shape)
+		t.Fail()
+	}
+	if shape.AveragePathLength != 4.5 {
+		log.Error("Expected average path length 4.5, saw %v", shape.AveragePathLength)
+		t.Fail()
+	}
+}
@@ -0,0 +1,131 @@
+package redblack
+
+import "expvar"
+import "sync/atomic"
+
+//=============================================================================
+//
+// Statistics
+//
+//=============================================================================
+
+/*
+Counts of the work done by a tree since statistics were enabled or last reset
+*/
+type Stats struct {
+	/*
+		Number of key comparisons
+	*/
+	Comparisons uint64
+	/*
+		Number of left and right rotations
+	*/
+	RotateLefts  uint64
+	RotateRights uint64
+	/*
+		Number of times the colors of a node and its children were flipped
+	*/
+	ColorFlips uint64
+	/*
+		Number of calls to moveRedLeft and moveRedRight while deleting
+	*/
+	MoveRedLefts  uint64
+	MoveRedRights uint64
+	/*
+		Number of nodes created
+	*/
+	Allocations uint64
+	/*
+		Deepest level reached by a search, insert, delete, pop or range
+		delete, where the root is at depth 1
+	*/
+	MaxDepth int
+}
+
+/*
+Counters held by a tree while statistics are enabled.  They are atomic so
+that Stats and ResetStats may be called from other goroutines, such as
+expvar's HTTP handlers, while the tree is in use; depth tracks the level of
+the current recursive operation, and is only used by the tree's goroutine.
+*/
+type statsCounter struct {
+	comparisons   atomic.Uint64
+	rotateLefts   atomic.Uint64
+	rotateRights  atomic.Uint64
+	colorFlips    atomic.Uint64
+	moveRedLefts  atomic.Uint64
+	moveRedRights atomic.Uint64
+	allocations   atomic.Uint64
+	maxDepth      atomic.Int64
+	depth         int
+}
+
+func (stats *statsCounter) enter() {
+	stats.depth++
+	stats.reached(stats.depth)
+}
+
+func (stats *statsCounter) leave() {
+	stats.depth--
+}
+
+func (stats *statsCounter) reached(depth int) {
+	for {
+		max := stats.maxDepth.Load()
+		if int64(depth) <= max || stats.maxDepth.CompareAndSwap(max, int64(depth)) {
+			return
+		}
+	}
+}
+
+func (tree *llrb) Stats() Stats {
+	stats := tree.stats
+	if stats == nil {
+		return Stats{}
+	}
+	return Stats{
+		Comparisons:   stats.comparisons.Load(),
+		RotateLefts:   stats.rotateLefts.Load(),
+		RotateRights:  stats.rotateRights.Load(),
+		ColorFlips:    stats.colorFlips.Load(),
+		MoveRedLefts:  stats.moveRedLefts.Load(),
+		MoveRedRights: stats.moveRedRights.Load(),
+		Allocations:   stats.allocations.Load(),
+		MaxDepth:      int(stats.maxDepth.Load()),
+	}
+}
+
+func (tree *llrb) ResetStats() {
+	stats := tree.stats
+	if stats == nil {
+		return
+	}
+	for _, counter := range []*atomic.Uint64{
+		&stats.comparisons, &stats.rotateLefts, &stats.rotateRights, &stats.colorFlips,
+		&stats.moveRedLefts, &stats.moveRedRights, &stats.allocations,
+	} {
+		counter.Store(0)
+	}
+	stats.maxDepth.Store(0)
+}
+
+func (tree *llrb) SetStatsEnabled(enabled bool) {
+	if !enabled {
+		tree.stats = nil
+	} else if tree.stats == nil {
+		tree.stats = &statsCounter{}
+	}
+}
+
+/*
+Create an expvar.Var reporting the current statistics of tree as JSON, for
+publishing with expvar.Publish.  Statistics must be enabled on the tree
+separately with SetStatsEnabled, before the variable is published: the
+counters may be read while the tree is in use, but enabling or disabling
+them may not happen at the same time.
+*/
+func NewStatsVar(tree LLRB) expvar.Var {
+	return expvar.Func(func() interface{} {
+		return tree.Stats()
+	})
+}
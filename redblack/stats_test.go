@@ -0,0 +1,134 @@
+package redblack
+
+import "encoding/json"
+import "sync"
+import "testing"
+
+func TestStatsDisabled(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	if tree.Stats() != (Stats{}) {
+		log.Error("Expected no statistics without enabling them, saw %+v", tree.Stats())
+		t.Fail()
+	}
+}
+
+func TestStats(t *testing.T) {
+	tree := NewLLRB()
+	tree.SetStatsEnabled(true)
+	tree.Insert(IntKey(1), StringValue("1"))
+	tree.Insert(IntKey(2), StringValue("2"))
+	tree.Insert(IntKey(3), StringValue("3"))
+	expected := Stats{
+		Comparisons:  2,
+		RotateLefts:  2,
+		RotateRights: 1,
+		Allocations:  3,
+		MaxDepth:     2,
+	}
+	if tree.Stats() != expected {
+		log.Error("Expected statistics %+v, saw %+v", expected, tree.Stats())
+		t.Fail()
+	}
+	tree.ResetStats()
+	tree.Search(IntKey(3))
+	expected = Stats{Comparisons: 2, MaxDepth: 2}
+	if tree.Stats() != expected {
+		log.Error("Expected statistics after reset %+v, saw %+v", expected, tree.Stats())
+		t.Fail()
+	}
+	tree.ResetStats()
+	for i := 4; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	for i := 1; i <= 100; i += 2 {
+		tree.Delete(IntKey(i))
+	}
+	stats := tree.Stats()
+	if stats.Allocations != 97 || stats.ColorFlips == 0 || stats.MoveRedLefts == 0 || stats.MoveRedRights == 0 {
+		log.Error("Expected 97 allocations and some flips and moves, saw %+v", stats)
+		t.Fail()
+	}
+	if stats.MaxDepth < 7 || stats.MaxDepth > 14 {
+		log.Error("Expected maximum depth between 7 and 14, saw %v", stats.MaxDepth)
+		t.Fail()
+	}
+	tree.SetStatsEnabled(false)
+	tree.Insert(IntKey(1), StringValue("1"))
+	if tree.Stats() != (Stats{}) {
+		log.Error("Expected no statistics after disabling them, saw %+v", tree.Stats())
+		t.Fail()
+	}
+}
+
+func TestStatsDepthOfRemovals(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tree.SetStatsEnabled(true)
+	removals := map[string]func(){
+		"PopMin":      func() { tree.PopMin() },
+		"PopMax":      func() { tree.PopMax() },
+		"DeleteMin":   func() { tree.DeleteMin() },
+		"DeleteRange": func() { tree.DeleteRange(IntKey(40), IntKey(45)) },
+	}
+	for name, remove := range removals {
+		tree.ResetStats()
+		// rotations on the way down can make the path followed a little
+		// longer than the height of the tree beforehand
+		height := tree.Height()
+		remove()
+		if depth := tree.Stats().MaxDepth; depth < 3 || depth > 2*height {
+			log.Error("Expected %v to reach a depth between 3 and %v, saw %v", name, 2*height, depth)
+			t.Fail()
+		}
+	}
+}
+
+func TestStatsConcurrentRead(t *testing.T) {
+	tree := NewLLRB()
+	tree.SetStatsEnabled(true)
+	v := NewStatsVar(tree)
+	done := make(chan bool)
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = v.String()
+			}
+		}
+	}()
+	for i := 1; i <= 1000; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	close(done)
+	wait.Wait()
+	if tree.Stats().Allocations != 1000 {
+		log.Error("Expected 1000 allocations, saw %v", tree.Stats().Allocations)
+		t.Fail()
+	}
+}
+
+func TestStatsVar(t *testing.T) {
+	tree := NewLLRB()
+	tree.SetStatsEnabled(true)
+	tree.Insert(IntKey(1), StringValue("1"))
+	v := NewStatsVar(tree)
+	var stats Stats
+	if err := json.Unmarshal([]byte(v.String()), &stats); err != nil {
+		log.Error("Failed decoding expvar output %v: %v", v.String(), err)
+		t.FailNow()
+	}
+	if stats != tree.Stats() {
+		log.Error("Expected expvar to report %+v, saw %+v", tree.Stats(), stats)
+		t.Fail()
+	}
+}
@@ -0,0 +1,523 @@
+package redblack
+
+import "bufio"
+import "bytes"
+import "crypto/sha256"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+import "reflect"
+
+//=============================================================================
+//
+// Replica synchronization
+//
+//=============================================================================
+
+/*
+A summary of the entries in a range of keys that does not depend on the
+shape of the tree holding them: their number, and the SHA-256 hash of the
+Merkle leaf hash of each entry (the hash a MerkleTree gives a node with no
+children) in key order
+*/
+type Digest struct {
+	Count int
+	Sum   [sha256.Size]byte
+}
+
+/*
+A red-black tree that can be synchronized with replicas elsewhere using Sync;
+as with a MerkleTree, its keys and values must have registered codecs
+*/
+type ReplicaTree interface {
+	LLRB
+	/*
+		Return the digest of the entries with keys not less than low and
+		less than high, where a nil bound is unbounded, or an error if
+		any of them cannot be hashed
+	*/
+	Digest(low, high Key) (Digest, error)
+
+	// Internal methods
+
+	before(bound Key) int
+	count(low, high Key) int
+	nth(i int) Key
+}
+
+type replicaTree struct {
+	AugmentedLLRB
+}
+
+type countMonoid struct{}
+
+/*
+Create a new, empty in-memory replica tree
+*/
+func NewReplicaTree() ReplicaTree {
+	return &replicaTree{NewAugmentedLLRB(countMonoid{})}
+}
+
+func (tree *replicaTree) Clone() LLRB {
+	return &replicaTree{tree.AugmentedLLRB.Clone().(AugmentedLLRB)}
+}
+
+func (tree *replicaTree) Digest(low, high Key) (Digest, error) {
+	d := Digest{}
+	sum := sha256.New()
+	var err error
+	walkRange(tree.Root(), low, high, func(h Node) {
+		if err != nil {
+			return
+		}
+		var leaf []byte
+		if leaf, err = hashEntry(h.Key(), h.Value(), nil, nil); err == nil {
+			sum.Write(leaf)
+			d.Count++
+		}
+	})
+	if err != nil {
+		return Digest{}, err
+	}
+	copy(d.Sum[:], sum.Sum(nil))
+	return d, nil
+}
+
+/*
+Return the number of keys not less than low and less than high, where a nil
+bound is unbounded
+*/
+func (tree *replicaTree) count(low, high Key) int {
+	if high == nil {
+		return aggregate(tree.Root(), countMonoid{}).(int) - tree.before(low)
+	}
+	return tree.before(high) - tree.before(low)
+}
+
+/*
+Return the number of keys less than bound, or none if bound is nil
+*/
+func (tree *replicaTree) before(bound Key) int {
+	m := countMonoid{}
+	if bound == nil {
+		return 0
+	}
+	n := 0
+	for h := tree.Root(); h != nil; {
+		if h.Key().Compare(bound) < 0 {
+			n += aggregate(h.Left(), m).(int) + 1
+			h = h.Right()
+		} else {
+			h = h.Left()
+		}
+	}
+	return n
+}
+
+/*
+Return the key that i keys precede, which must exist
+*/
+func (tree *replicaTree) nth(i int) Key {
+	m := countMonoid{}
+	h := tree.Root()
+	for {
+		left := aggregate(h.Left(), m).(int)
+		if i < left {
+			h = h.Left()
+		} else if i == left {
+			return h.Key()
+		} else {
+			i -= left + 1
+			h = h.Right()
+		}
+	}
+}
+
+func (m countMonoid) Identity() interface{} {
+	return 0
+}
+
+func (m countMonoid) Combine(a, b interface{}) interface{} {
+	return a.(int) + b.(int)
+}
+
+func (m countMonoid) Measure(key Key, value Value) interface{} {
+	return 1
+}
+
+//
+// Protocol
+//
+
+/*
+Ranges holding no more than this many entries on either side are exchanged
+in full rather than split further, as long as neither side holds more than
+syncMaxRangeEntries
+*/
+const (
+	syncRangeEntries    = 16
+	syncMaxRangeEntries = 1024
+)
+
+/*
+The largest message either side will send or receive; longer ones can only
+come from a faulty or hostile peer, or from values too large to sync
+*/
+const syncMaxMessage = 64 << 20
+
+const (
+	syncDigest = iota
+	syncEntries
+	syncDone
+	syncSplit
+)
+
+/*
+Bring tree and a replica on the other end of rw into agreement, so that both
+hold every key held by either.  One side must lead and the other follow;
+the leader compares digests of ever smaller ranges of keys with the follower,
+and only the entries in ranges that differ are sent in either direction.
+
+Where both sides hold a key with different values, both replace it with
+resolve(key, local, remote).  Resolve must give the same answer whichever
+side's value is local for the replicas to converge; if it is nil, the value
+whose Merkle leaf hash is greater wins.  Deleting a key from one replica
+does not delete it from others, since a missing key looks like one that was
+never added.
+
+Ranges are compared by Digest, which hashes the same per-entry leaf hashes
+as a MerkleTree, rather than by the hashes of whole subtrees, because those
+depend on the shape of the tree as well as its contents: replicas holding
+the same entries but built in a different order have different hashes for
+every subtree.  A digest covers exactly the entries in its range, so both
+sides can compare the same ranges; computing one takes time proportional to
+the number of entries in the range.
+*/
+func Sync(tree ReplicaTree, rw io.ReadWriter, lead bool, resolve func(key Key, local, remote Value) Value) error {
+	if resolve == nil {
+		resolve = resolveByHash
+	}
+	s := &syncSession{tree, bufio.NewReader(rw), rw, resolve}
+	if lead {
+		return s.lead()
+	}
+	return s.follow()
+}
+
+type syncSession struct {
+	tree    ReplicaTree
+	in      *bufio.Reader
+	out     io.Writer
+	resolve func(key Key, local, remote Value) Value
+}
+
+func (s *syncSession) lead() error {
+	ranges := [][2]Key{{nil, nil}}
+	for len(ranges) > 0 {
+		low, high := ranges[len(ranges)-1][0], ranges[len(ranges)-1][1]
+		ranges = ranges[:len(ranges)-1]
+		local, err := s.tree.Digest(low, high)
+		if err != nil {
+			return err
+		}
+		request, err := appendBounds([]byte{syncDigest}, low, high)
+		if err != nil {
+			return err
+		}
+		reply, err := s.exchange(request)
+		if err != nil {
+			return err
+		}
+		remote, err := readDigest(reply)
+		if err != nil {
+			return err
+		}
+		if remote == local {
+			continue
+		}
+		larger := local.Count
+		if remote.Count > larger {
+			larger = remote.Count
+		}
+		if (local.Count <= syncRangeEntries || remote.Count <= syncRangeEntries) && larger <= syncMaxRangeEntries {
+			entries, err := s.appendEntries([]byte{syncEntries}, low, high)
+			if err != nil {
+				return err
+			}
+			if reply, err = s.exchange(entries); err != nil {
+				return err
+			}
+			if err = s.merge(reply); err != nil {
+				return err
+			}
+			continue
+		}
+		// split at the median of the side with more keys in range; with
+		// more than one key there, both halves are smaller than the whole
+		var split Key
+		if local.Count >= remote.Count {
+			split = s.tree.nth(s.tree.before(low) + local.Count/2)
+		} else {
+			request, err := appendBounds([]byte{syncSplit}, low, high)
+			if err != nil {
+				return err
+			}
+			if reply, err = s.exchange(request); err != nil {
+				return err
+			}
+			if split, err = readKey(reply); err != nil {
+				return err
+			}
+			if (low != nil && split.Compare(low) <= 0) || (high != nil && split.Compare(high) >= 0) {
+				return fmt.Errorf("split key %v is not inside range", split)
+			}
+		}
+		ranges = append(ranges, [2]Key{split, high}, [2]Key{low, split})
+	}
+	return s.send([]byte{syncDone})
+}
+
+func (s *syncSession) follow() error {
+	for {
+		request, err := s.receive()
+		if err != nil {
+			return err
+		}
+		if len(request) == 0 {
+			return errors.New("empty sync message")
+		}
+		switch request[0] {
+		case syncDigest:
+			low, high, rest, err := readBounds(request[1:])
+			if err != nil {
+				return err
+			}
+			if len(rest) > 0 {
+				return errors.New("unexpected data after digest request")
+			}
+			d, err := s.tree.Digest(low, high)
+			if err != nil {
+				return err
+			}
+			if err = s.send(appendDigest(nil, d)); err != nil {
+				return err
+			}
+		case syncEntries:
+			low, high, _, err := readBounds(request[1:])
+			if err != nil {
+				return err
+			}
+			// reply with the entries held before merging the leader's
+			entries, err := s.appendEntries([]byte{syncEntries}, low, high)
+			if err != nil {
+				return err
+			}
+			if err = s.send(entries); err != nil {
+				return err
+			}
+			if err = s.merge(request); err != nil {
+				return err
+			}
+		case syncSplit:
+			low, high, rest, err := readBounds(request[1:])
+			if err != nil {
+				return err
+			}
+			if len(rest) > 0 {
+				return errors.New("unexpected data after split request")
+			}
+			count := s.tree.count(low, high)
+			if count < 2 {
+				return errors.New("split requested for range with fewer than 2 keys")
+			}
+			reply, err := appendBinary(nil, s.tree.nth(s.tree.before(low)+count/2))
+			if err != nil {
+				return err
+			}
+			if err = s.send(reply); err != nil {
+				return err
+			}
+		case syncDone:
+			return nil
+		default:
+			return fmt.Errorf("unknown sync message %v", request[0])
+		}
+	}
+}
+
+/*
+Merge the entries in a syncEntries message into the tree; every entry must
+lie inside the range the message names
+*/
+func (s *syncSession) merge(message []byte) error {
+	if len(message) == 0 || message[0] != syncEntries {
+		return errors.New("expected entries")
+	}
+	low, high, data, err := readBounds(message[1:])
+	if err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errors.New("malformed entry count")
+	}
+	data = data[n:]
+	for i := uint64(0); i < count; i++ {
+		var key Key
+		var remote Value
+		if key, remote, data, err = readProofEntry(data); err != nil {
+			return err
+		}
+		if (low != nil && key.Compare(low) < 0) || (high != nil && key.Compare(high) >= 0) {
+			return fmt.Errorf("entry for key %v is outside range %v to %v", key, low, high)
+		}
+		if local := s.tree.Search(key); local == nil {
+			s.tree.Insert(key, remote)
+		} else if !reflect.DeepEqual(local, remote) {
+			s.tree.Insert(key, s.resolve(key, local, remote))
+		}
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%v unexpected bytes after last entry", len(data))
+	}
+	return nil
+}
+
+/*
+Append the bounds of a range, and the entries held in it, to data
+*/
+func (s *syncSession) appendEntries(data []byte, low, high Key) ([]byte, error) {
+	data, err := appendBounds(data, low, high)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]byte, 0)
+	count := 0
+	walkRange(s.tree.Root(), low, high, func(h Node) {
+		if err != nil {
+			return
+		}
+		entries, err = appendProofEntry(entries, h.Key(), h.Value())
+		count++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(binary.AppendUvarint(data, uint64(count)), entries...), nil
+}
+
+/*
+Send a message and wait for the reply
+*/
+func (s *syncSession) exchange(message []byte) ([]byte, error) {
+	if err := s.send(message); err != nil {
+		return nil, err
+	}
+	return s.receive()
+}
+
+/*
+Messages are framed by a uvarint length
+*/
+func (s *syncSession) send(message []byte) error {
+	if len(message) > syncMaxMessage {
+		return fmt.Errorf("sync message of %v bytes exceeds limit of %v", len(message), syncMaxMessage)
+	}
+	_, err := s.out.Write(appendBytes(nil, message))
+	return err
+}
+
+func (s *syncSession) receive() ([]byte, error) {
+	length, err := binary.ReadUvarint(s.in)
+	if err != nil {
+		return nil, err
+	}
+	if length > syncMaxMessage {
+		return nil, fmt.Errorf("sync message of %v bytes exceeds limit of %v", length, syncMaxMessage)
+	}
+	message := make([]byte, length)
+	_, err = io.ReadFull(s.in, message)
+	return message, err
+}
+
+func appendBounds(data []byte, low, high Key) ([]byte, error) {
+	for _, bound := range []Key{low, high} {
+		if bound == nil {
+			data = append(data, 0)
+			continue
+		}
+		var err error
+		if data, err = appendBinary(append(data, 1), bound); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func readBounds(data []byte) (Key, Key, []byte, error) {
+	bounds := make([]Key, 2)
+	for i := range bounds {
+		if len(data) == 0 || data[0] > 1 {
+			return nil, nil, nil, errors.New("malformed range bound")
+		}
+		bounded := data[0] == 1
+		data = data[1:]
+		if !bounded {
+			continue
+		}
+		k, rest, err := readBinary(data)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		key, ok := k.(Key)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("%T is not a key", k)
+		}
+		bounds[i], data = key, rest
+	}
+	return bounds[0], bounds[1], data, nil
+}
+
+func readKey(data []byte) (Key, error) {
+	k, rest, err := readBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("unexpected data after key")
+	}
+	key, ok := k.(Key)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a key", k)
+	}
+	return key, nil
+}
+
+func appendDigest(data []byte, d Digest) []byte {
+	return append(binary.AppendUvarint(data, uint64(d.Count)), d.Sum[:]...)
+}
+
+func readDigest(data []byte) (Digest, error) {
+	d := Digest{}
+	count, n := binary.Uvarint(data)
+	if n <= 0 || len(data)-n != len(d.Sum) {
+		return d, errors.New("malformed digest")
+	}
+	d.Count = int(count)
+	copy(d.Sum[:], data[n:])
+	return d, nil
+}
+
+/*
+Choose the value whose Merkle leaf hash is greater; a value that cannot be
+hashed loses to one that can, so that both sides choose the same one
+*/
+func resolveByHash(key Key, local, remote Value) Value {
+	localHash, localErr := hashEntry(key, local, nil, nil)
+	remoteHash, remoteErr := hashEntry(key, remote, nil, nil)
+	if remoteErr != nil || (localErr == nil && bytes.Compare(localHash, remoteHash) >= 0) {
+		return local
+	}
+	return remote
+}
@@ -0,0 +1,245 @@
+package redblack
+
+import "bufio"
+import "encoding/binary"
+import "io"
+import "net"
+import "testing"
+
+func TestDigest(t *testing.T) {
+	a, b := NewReplicaTree(), NewReplicaTree()
+	for i := 0; i < 100; i++ {
+		a.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		b.Insert(IntKey(99-i), StringValue(IntKey(99-i).String()))
+	}
+	if digest(a, nil, nil) != digest(b, nil, nil) || digest(a, nil, nil).Count != 100 {
+		log.Error("Expected equal digests of 100 entries for trees built in different orders")
+		t.Fail()
+	}
+	if d := digest(a, IntKey(10), IntKey(20)); d.Count != 10 || d != digest(b, IntKey(10), IntKey(20)) {
+		log.Error("Expected equal digests of 10 entries, saw %v", d.Count)
+		t.Fail()
+	}
+	if digest(a, nil, IntKey(50)) == digest(a, IntKey(50), nil) || digest(a, IntKey(200), nil) != (Digest{Count: 0, Sum: digest(NewReplicaTree(), nil, nil).Sum}) {
+		log.Error("Expected digests of different ranges to differ, and empty ranges to match")
+		t.Fail()
+	}
+	b.Insert(IntKey(15), StringValue("changed"))
+	if digest(a, IntKey(10), IntKey(20)) == digest(b, IntKey(10), IntKey(20)) {
+		log.Error("Expected digests to differ after changing a value")
+		t.Fail()
+	}
+	if digest(a, IntKey(20), nil) != digest(b, IntKey(20), nil) {
+		log.Error("Expected digests of unchanged range to match")
+		t.Fail()
+	}
+	// moving a value from one key to another keeps the multiset of values
+	// but must still change the digest
+	c := a.Clone().(ReplicaTree)
+	c.Insert(IntKey(3), a.Search(IntKey(4)))
+	c.Insert(IntKey(4), a.Search(IntKey(3)))
+	if digest(a, nil, nil) == digest(c, nil, nil) {
+		log.Error("Expected digests to differ after swapping values")
+		t.Fail()
+	}
+}
+
+func TestDigestUnregisteredValue(t *testing.T) {
+	a, b := NewReplicaTree(), NewReplicaTree()
+	a.Insert(IntKey(1), unregisteredValue{})
+	if _, err := a.Digest(nil, nil); err == nil {
+		log.Error("Expected error digesting value without a codec")
+		t.Fail()
+	}
+	if _, err := a.Digest(IntKey(2), nil); err != nil {
+		log.Error("Expected no error digesting range without it, saw %v", err)
+		t.Fail()
+	}
+	lead, follow := net.Pipe()
+	defer follow.Close()
+	go Sync(b, follow, false, nil)
+	if err := Sync(a, lead, true, nil); err == nil {
+		log.Error("Expected error syncing value without a codec")
+		t.Fail()
+	}
+	lead.Close()
+}
+
+func TestSync(t *testing.T) {
+	a, b := NewReplicaTree(), NewReplicaTree()
+	for i := 0; i < 5000; i++ {
+		a.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		b.Insert(IntKey(4999-i), StringValue(IntKey(4999-i).String()))
+	}
+	a.Delete(IntKey(10))
+	a.Insert(IntKey(6000), StringValue("only a"))
+	b.DeleteRange(IntKey(3000), IntKey(3004))
+	b.Insert(IntKey(-1), StringValue("only b"))
+	a.Insert(IntKey(2500), StringValue("a's"))
+	b.Insert(IntKey(2500), StringValue("b's"))
+	sent, received := syncPair(t, a, b, nil)
+	if changes := Diff(a, b); len(changes) != 0 {
+		log.Error("Expected replicas to converge, saw changes %v", changes)
+		t.Fail()
+	}
+	if a.Size() != 5002 || a.Search(IntKey(10)) == nil || a.Search(IntKey(3002)) == nil || b.Search(IntKey(6000)) == nil {
+		log.Error("Expected replicas to hold the union of their keys, saw %v keys", a.Size())
+		t.Fail()
+	}
+	if value := a.Search(IntKey(2500)); value != resolveByHash(IntKey(2500), StringValue("a's"), StringValue("b's")) {
+		log.Error("Expected conflict resolved by hash, saw %v", value)
+		t.Fail()
+	}
+	// a full copy would take well over 50KB in each direction
+	if sent > 10000 || received > 10000 {
+		log.Error("Expected only differing ranges to be sent, but sent %v and received %v bytes", sent, received)
+		t.Fail()
+	}
+	if sent, received = syncPair(t, a, b, nil); sent+received > 100 {
+		log.Error("Expected only root digests to be exchanged between converged replicas, saw %v bytes", sent+received)
+		t.Fail()
+	}
+}
+
+func TestSyncResolve(t *testing.T) {
+	a, b := NewReplicaTree(), NewReplicaTree()
+	for i := 0; i < 100; i++ {
+		a.Insert(IntKey(i), IntValue(i))
+		b.Insert(IntKey(i), IntValue(100-i))
+	}
+	larger := func(key Key, local, remote Value) Value {
+		if local.(IntValue) > remote.(IntValue) {
+			return local
+		}
+		return remote
+	}
+	syncPair(t, a, b, larger)
+	for i := 0; i < 100; i++ {
+		expected := IntValue(i)
+		if i < 50 {
+			expected = IntValue(100 - i)
+		}
+		if a.Search(IntKey(i)) != expected || b.Search(IntKey(i)) != expected {
+			log.Error("Expected %v for key %v, saw %v and %v", expected, i, a.Search(IntKey(i)), b.Search(IntKey(i)))
+			t.Fail()
+		}
+	}
+}
+
+func TestSyncEmpty(t *testing.T) {
+	a, b := NewReplicaTree(), NewReplicaTree()
+	syncPair(t, a, b, nil)
+	for i := 0; i < 100; i++ {
+		b.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	syncPair(t, a, b, nil)
+	if a.Size() != 100 || len(Diff(a, b)) != 0 {
+		log.Error("Expected empty replica to receive all 100 keys, saw %v", a.Size())
+		t.Fail()
+	}
+}
+
+func TestSyncLargeRange(t *testing.T) {
+	a, b := NewReplicaTree(), NewReplicaTree()
+	for i := 0; i < 5000; i++ {
+		b.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	a.Insert(IntKey(2500), StringValue("2500"))
+	syncPair(t, a, b, nil)
+	if a.Size() != 5000 || len(Diff(a, b)) != 0 {
+		log.Error("Expected nearly empty leader to receive all 5000 keys, saw %v", a.Size())
+		t.Fail()
+	}
+}
+
+func TestSyncMalformed(t *testing.T) {
+	// entries for the range 0 to 10 including key 50, outside it
+	outside, _ := appendBounds([]byte{syncEntries}, IntKey(0), IntKey(10))
+	outside = binary.AppendUvarint(outside, 1)
+	outside, _ = appendProofEntry(outside, IntKey(50), StringValue("50"))
+	messages := [][]byte{
+		{2, 9, 9},
+		// a frame claiming a length of 1<<62 bytes
+		binary.AppendUvarint(nil, 1<<62),
+		// a split request for an empty range
+		{3, syncSplit, 0, 0},
+		appendBytes(nil, outside),
+	}
+	for _, message := range messages {
+		lead, follow := net.Pipe()
+		go func() {
+			lead.Write(message)
+			// wait for any reply, then hang up
+			binary.ReadUvarint(bufio.NewReader(lead))
+			lead.Close()
+		}()
+		tree := NewReplicaTree()
+		if err := Sync(tree, follow, false, nil); err == nil {
+			log.Error("Expected error following malformed message %v", message)
+			t.Fail()
+		}
+		follow.Close()
+		if tree.Size() != 0 {
+			log.Error("Expected no entries merged from malformed message %v", message)
+			t.Fail()
+		}
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+/*
+Synchronize a and b over a pipe, with a leading, returning the number of
+bytes a sent and received
+*/
+func syncPair(t *testing.T, a, b ReplicaTree, resolve func(key Key, local, remote Value) Value) (int, int) {
+	lead, follow := net.Pipe()
+	defer lead.Close()
+	defer follow.Close()
+	counted := &countingReadWriter{rw: lead}
+	done := make(chan error)
+	go func() {
+		done <- Sync(b, follow, false, resolve)
+	}()
+	if err := Sync(a, counted, true, resolve); err != nil {
+		log.Error("Leader failed: %v", err)
+		t.Fail()
+	}
+	if err := <-done; err != nil {
+		log.Error("Follower failed: %v", err)
+		t.Fail()
+	}
+	if !checkBalance(a) || !checkBalance(b) {
+		t.Fail()
+	}
+	return counted.written, counted.read
+}
+
+func digest(tree ReplicaTree, low, high Key) Digest {
+	d, err := tree.Digest(low, high)
+	if err != nil {
+		log.Error("Failed digesting range %v to %v: %v", low, high, err)
+	}
+	return d
+}
+
+type countingReadWriter struct {
+	rw            io.ReadWriter
+	read, written int
+}
+
+func (c *countingReadWriter) Read(p []byte) (int, error) {
+	n, err := c.rw.Read(p)
+	c.read += n
+	return n, err
+}
+
+func (c *countingReadWriter) Write(p []byte) (int, error) {
+	n, err := c.rw.Write(p)
+	c.written += n
+	return n, err
+}
@@ -1 +1,117 @@
-package redblack
\ No newline at end of file
+package redblack
+
+import "bufio"
+import "fmt"
+import "io"
+import "strconv"
+import "strings"
+
+//=============================================================================
+//
+// Text format
+//
+//=============================================================================
+
+/*
+Write the contents of the tree to w in key order, one key and value per line.
+The key and the value are each written as the tag of their codec, a space,
+and their text as a double-quoted Go string literal, so that the line for
+key 1 with value "one" is:
+
+	IntKey "1" StringValue "one"
+*/
+func WriteText(w io.Writer, tree LLRB) error {
+	out := bufio.NewWriter(w)
+	var err error
+	walk(tree.Root(), func(h Node) {
+		if err != nil {
+			return
+		}
+		var key, value string
+		if key, err = encodeText(h.Key()); err != nil {
+			return
+		}
+		if value, err = encodeText(h.Value()); err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(out, "%v %v\n", key, value)
+	})
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+/*
+Read keys and values written by WriteText into a new tree using the
+provided implementation.  Blank lines, and lines starting with #, are ignored.
+*/
+func ReadText(r io.Reader, impl LLRBImpl) (LLRB, error) {
+	tree := NewRedBlackTree(impl)
+	in := bufio.NewReader(r)
+	for number := 1; ; number++ {
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if text := strings.TrimSpace(line); text != "" && !strings.HasPrefix(text, "#") {
+			key, value, parseErr := parseTextLine(text)
+			if parseErr != nil {
+				return nil, fmt.Errorf("line %v: %v", number, parseErr)
+			}
+			tree.Insert(key, value)
+		}
+		if err == io.EOF {
+			return tree, nil
+		}
+	}
+}
+
+func encodeText(v interface{}) (string, error) {
+	tag, text, err := encodeTagged(v)
+	if err != nil {
+		return "", err
+	}
+	return tag + " " + strconv.Quote(text), nil
+}
+
+func parseTextLine(line string) (Key, Value, error) {
+	k, rest, err := decodeText(line)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, rest, err := decodeText(strings.TrimLeft(rest, " \t"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if rest != "" {
+		return nil, nil, fmt.Errorf("unexpected text after value: %v", rest)
+	}
+	return asEntry(k, v)
+}
+
+/*
+Decode the tag and quoted text at the start of s, returning the decoded key
+or value and the remainder of s
+*/
+func decodeText(s string) (interface{}, string, error) {
+	space := strings.IndexAny(s, " \t")
+	if space < 0 {
+		return nil, "", fmt.Errorf("expected a tag and quoted text: %v", s)
+	}
+	tag := s[:space]
+	s = strings.TrimLeft(s[space:], " \t")
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("expected quoted text: %v", s)
+	}
+	text, err := strconv.Unquote(quoted)
+	if err != nil {
+		return nil, "", err
+	}
+	v, err := decodeTagged(tag, text)
+	if err != nil {
+		return nil, "", err
+	}
+	return v, s[len(quoted):], nil
+}
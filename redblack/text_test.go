@@ -0,0 +1,118 @@
+package redblack
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestTextRoundTrip(t *testing.T) {
+	tree := NewLLRB()
+	tree.Insert(IntKey(3), StringValue("three"))
+	tree.Insert(IntKey(1), StringValue("with \"quotes\"\nand a newline"))
+	tree.Insert(IntKey(-2), BytesValue([]byte{0, 0xff, '\n'}))
+	tree.Insert(IntKey(4), StringValue(""))
+	var buf bytes.Buffer
+	if err := WriteText(&buf, tree); err != nil {
+		log.Error("Failed writing text: %v", err)
+		t.FailNow()
+	}
+	expected := `IntKey "-2" BytesValue "00ff0a"
+IntKey "1" StringValue "with \"quotes\"\nand a newline"
+IntKey "3" StringValue "three"
+IntKey "4" StringValue ""
+`
+	if buf.String() != expected {
+		log.Error("Expected text:\n%v\nsaw:\n%v", expected, buf.String())
+		t.Fail()
+	}
+	copied, err := ReadText(&buf, NewMemoryLLRBImpl())
+	if err != nil {
+		log.Error("Failed reading text: %v", err)
+		t.FailNow()
+	}
+	if !checkSameContents(tree, copied) {
+		t.Fail()
+	}
+	clone := copied.Clone()
+	clone.Delete(IntKey(3))
+	if copied.Search(IntKey(3)) == nil || clone.Search(IntKey(3)) != nil {
+		log.Error("Expected delete from clone of tree read from text to leave original unchanged")
+		t.Fail()
+	}
+}
+
+func TestReadTextCommentsAndBlankLines(t *testing.T) {
+	text := "# fixture\n\nIntKey \"1\"  StringValue \"one\"\n\t\nIntKey \"2\" StringValue \"two\""
+	tree, err := ReadText(strings.NewReader(text), NewMemoryLLRBImpl())
+	if err != nil {
+		log.Error("Failed reading text: %v", err)
+		t.FailNow()
+	}
+	if tree.Size() != 2 || tree.Search(IntKey(2)).String() != "two" {
+		log.Error("Unexpected tree read from text:\n%v", tree)
+		t.Fail()
+	}
+}
+
+func TestReadTextErrors(t *testing.T) {
+	bad := []string{
+		"IntKey \"1\"",
+		"IntKey 1 StringValue \"one\"",
+		"NoSuchKey \"1\" StringValue \"one\"",
+		"IntKey \"one\" StringValue \"one\"",
+		"IntKey \"1\" StringValue \"one\" extra",
+		"IntKey \"1\" BytesValue \"xyz\"",
+		"StringValue \"1\" StringValue \"one\"",
+	}
+	for _, text := range bad {
+		if _, err := ReadText(strings.NewReader("IntKey \"0\" StringValue \"zero\"\n"+text), NewMemoryLLRBImpl()); err == nil {
+			log.Error("Expected error reading %v", text)
+			t.Fail()
+		} else if !strings.HasPrefix(err.Error(), "line 2:") {
+			log.Error("Expected error on line 2, saw %v", err)
+			t.Fail()
+		}
+	}
+}
+
+func TestWriteTextUnregisteredType(t *testing.T) {
+	tree := NewLLRB()
+	tree.Insert(IntKey(1), unregisteredValue{})
+	if err := WriteText(&bytes.Buffer{}, tree); err == nil {
+		log.Error("Expected error writing value without a codec")
+		t.Fail()
+	}
+}
+
+type unregisteredValue struct{}
+
+func (v unregisteredValue) String() string {
+	return "unregistered"
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+func checkSameContents(expected, actual LLRB) bool {
+	var keys, values []string
+	walk(expected.Root(), func(h Node) {
+		keys = append(keys, h.Key().String())
+		values = append(values, h.Value().String())
+	})
+	i := 0
+	allOk := true
+	walk(actual.Root(), func(h Node) {
+		if i >= len(keys) || h.Key().String() != keys[i] || h.Value().String() != values[i] {
+			log.Error("Unexpected key %v with value %v at position %v", h.Key(), h.Value(), i)
+			allOk = false
+		}
+		i++
+	})
+	if i != len(keys) {
+		log.Error("Expected %v keys, saw %v", len(keys), i)
+		allOk = false
+	}
+	return allOk
+}
@@ -0,0 +1,85 @@
+package redblack
+
+import "context"
+import "log/slog"
+
+//=============================================================================
+//
+// Tracing
+//
+//=============================================================================
+
+/*
+The kinds of structural change reported to a Tracer
+*/
+type TraceEvent int
+
+const (
+	/*
+		A key was inserted into the tree, or its value replaced
+	*/
+	TraceInsert TraceEvent = iota
+	/*
+		A key was deleted from the tree
+	*/
+	TraceDelete
+	/*
+		A node was rotated left; the key is that of the node rotated down
+	*/
+	TraceRotateLeft
+	/*
+		A node was rotated right; the key is that of the node rotated down
+	*/
+	TraceRotateRight
+	/*
+		The colors of a node and both its children were flipped
+	*/
+	TraceFlip
+)
+
+func (event TraceEvent) String() string {
+	switch event {
+	case TraceInsert:
+		return "insert"
+	case TraceDelete:
+		return "delete"
+	case TraceRotateLeft:
+		return "rotate left"
+	case TraceRotateRight:
+		return "rotate right"
+	case TraceFlip:
+		return "flip"
+	}
+	return "unknown"
+}
+
+/*
+Receives events as a tree changes shape; set one on a tree with SetTracer.
+Trees without a tracer do no tracing work at all.
+*/
+type Tracer interface {
+	/*
+		Report an event affecting the node with the provided key
+	*/
+	Trace(event TraceEvent, key Key)
+}
+
+/*
+Create a tracer that logs each event to logger at debug level, with the
+event as the message and the key as an attribute
+*/
+func NewSlogTracer(logger *slog.Logger) Tracer {
+	return &slogTracer{logger}
+}
+
+type slogTracer struct {
+	logger *slog.Logger
+}
+
+func (tracer *slogTracer) Trace(event TraceEvent, key Key) {
+	ctx := context.Background()
+	if !tracer.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	tracer.logger.LogAttrs(ctx, slog.LevelDebug, event.String(), slog.String("key", key.String()))
+}
@@ -0,0 +1,153 @@
+package redblack
+
+import "bytes"
+import "fmt"
+import "log/slog"
+import "strings"
+import "testing"
+
+func TestTracer(t *testing.T) {
+	tree := NewLLRB()
+	if tree.Tracer() != nil {
+		log.Error("Expected no tracer on a new tree")
+		t.Fail()
+	}
+	tracer := &recordingTracer{}
+	tree.SetTracer(tracer)
+	for i := 1; i <= 3; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tree.Delete(IntKey(1))
+	expected := []string{
+		"insert 1",
+		"insert 2", "rotate left 1",
+		"insert 3", "rotate left 2", "rotate right 3",
+		"delete 1", "rotate left 2",
+	}
+	if !tracer.check(expected) {
+		t.Fail()
+	}
+	tree.SetTracer(nil)
+	tree.Insert(IntKey(4), StringValue("4"))
+	if !tracer.check(expected) {
+		log.Error("Expected no events after removing tracer")
+		t.Fail()
+	}
+}
+
+func TestTracerPopMinMax(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 7; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tracer := &recordingTracer{}
+	tree.SetTracer(tracer)
+	tree.PopMin()
+	tree.PopMax()
+	tree.PopMax()
+	deletes := make([]string, 0)
+	for _, event := range tracer.events {
+		if strings.HasPrefix(event, "delete") {
+			deletes = append(deletes, event)
+		}
+	}
+	if fmt.Sprint(deletes) != "[delete 1 delete 7 delete 6]" {
+		log.Error("Expected deletes of 1, 7, and 6, saw %v", deletes)
+		t.Fail()
+	}
+}
+
+func TestTracerDeleteAbsent(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 7; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tracer := &recordingTracer{}
+	tree.SetTracer(tracer)
+	tree.Delete(IntKey(0))
+	tree.Delete(IntKey(4))
+	tree.Delete(IntKey(4))
+	tree.Delete(IntKey(8))
+	deletes := make([]string, 0)
+	for _, event := range tracer.events {
+		if strings.HasPrefix(event, "delete") {
+			deletes = append(deletes, event)
+		}
+	}
+	if fmt.Sprint(deletes) != "[delete 4]" {
+		log.Error("Expected only one delete of 4, saw %v", deletes)
+		t.Fail()
+	}
+}
+
+func TestTracerDeleteRange(t *testing.T) {
+	tree := NewLLRB()
+	for i := 1; i <= 20; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tracer := &recordingTracer{}
+	tree.SetTracer(tracer)
+	tree.DeleteRange(IntKey(5), IntKey(9))
+	tree.DeleteRange(IntKey(30), IntKey(40))
+	if len(tracer.events) < 5 || fmt.Sprint(tracer.events[:5]) != "[delete 5 delete 6 delete 7 delete 8 delete 9]" {
+		log.Error("Expected deletes of 5 to 9 before any rotations, saw %v", tracer.events)
+		t.Fail()
+	}
+	for _, event := range tracer.events[5:] {
+		if strings.HasPrefix(event, "delete") {
+			log.Error("Unexpected event %v after deletes", event)
+			t.Fail()
+		}
+	}
+}
+
+func TestSlogTracer(t *testing.T) {
+	var out bytes.Buffer
+	handler := slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})
+	tree := NewLLRB()
+	tree.SetTracer(NewSlogTracer(slog.New(handler)))
+	tree.Insert(IntKey(1), StringValue("one"))
+	tree.Insert(IntKey(2), StringValue("two"))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{`msg=insert key=1`, `msg=insert key=2`, `msg="rotate left" key=1`}
+	if len(lines) != len(expected) {
+		log.Error("Expected %v log lines, saw %v", len(expected), lines)
+		t.FailNow()
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "level=DEBUG "+expected[i]) {
+			log.Error("Expected log line ending in %v, saw %v", expected[i], line)
+			t.Fail()
+		}
+	}
+	out.Reset()
+	quiet := slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelInfo})
+	tree.SetTracer(NewSlogTracer(slog.New(quiet)))
+	tree.Insert(IntKey(3), StringValue("three"))
+	if out.Len() != 0 {
+		log.Error("Expected no output above debug level, saw %v", out.String())
+		t.Fail()
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+type recordingTracer struct {
+	events []string
+}
+
+func (tracer *recordingTracer) Trace(event TraceEvent, key Key) {
+	tracer.events = append(tracer.events, fmt.Sprintf("%v %v", event, key))
+}
+
+func (tracer *recordingTracer) check(expected []string) bool {
+	if fmt.Sprint(tracer.events) != fmt.Sprint(expected) {
+		log.Error("Expected events %v, saw %v", expected, tracer.events)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package redblack
+
+import "fmt"
+
+//=============================================================================
+//
+// Verification
+//
+//=============================================================================
+
+const (
+	InvariantBlackRoot    = "the root is black"
+	InvariantOrdered      = "keys are in order"
+	InvariantLeftLeaning  = "red links lean left"
+	InvariantNoDoubleRed  = "children of red nodes are black"
+	InvariantBlackBalance = "all paths have the same number of black nodes"
+)
+
+/*
+Describes a violation of one of the invariants of left-leaning red-black trees
+*/
+type InvariantError struct {
+	/*
+		The invariant violated, as one of the Invariant constants
+	*/
+	Invariant string
+	/*
+		The key of the node where the violation was found
+	*/
+	Key Key
+	/*
+		The keys of the nodes from the root down to the node where the
+		violation was found, inclusive
+	*/
+	Path []Key
+}
+
+func (err *InvariantError) Error() string {
+	return fmt.Sprintf("invariant violated (%v) at key %v on path %v", err.Invariant, err.Key, err.Path)
+}
+
+/*
+Check that the tree satisfies all of the invariants of a left-leaning
+red-black tree, returning an *InvariantError describing the first violation
+found, if any.  Useful for testing custom LLRBImpl implementations.
+
+Because insertion leaves 4-nodes in the tree, a red right link is allowed
+when the left link beside it is also red.
+*/
+func Verify(tree LLRB) error {
+	root := tree.Root()
+	if root == nil {
+		return nil
+	}
+	if isRed(root) {
+		return &InvariantError{InvariantBlackRoot, root.Key(), []Key{root.Key()}}
+	}
+	_, err := verify(root, nil, nil, nil)
+	return err
+}
+
+/*
+Verify the subtree at h, all of whose keys must fall strictly between low and
+high (where a nil bound is unbounded), returning its black height
+*/
+func verify(h Node, low, high Key, path []Key) (int, error) {
+	if h == nil {
+		return 0, nil
+	}
+	path = append(path[:len(path):len(path)], h.Key())
+	violation := func(invariant string) (int, error) {
+		return 0, &InvariantError{invariant, h.Key(), path}
+	}
+	if (low != nil && h.Key().Compare(low) <= 0) || (high != nil && h.Key().Compare(high) >= 0) {
+		return violation(InvariantOrdered)
+	}
+	if isRed(h.Right()) && !isRed(h.Left()) {
+		return violation(InvariantLeftLeaning)
+	}
+	if isRed(h) && (isRed(h.Left()) || isRed(h.Right())) {
+		return violation(InvariantNoDoubleRed)
+	}
+	left, err := verify(h.Left(), low, h.Key(), path)
+	if err != nil {
+		return 0, err
+	}
+	right, err := verify(h.Right(), h.Key(), high, path)
+	if err != nil {
+		return 0, err
+	}
+	if left != right {
+		return violation(InvariantBlackBalance)
+	}
+	if !isRed(h) {
+		left++
+	}
+	return left, nil
+}
@@ -0,0 +1,72 @@
+package redblack
+
+import "testing"
+
+func TestVerifyValidTrees(t *testing.T) {
+	tree := NewLLRB()
+	if err := Verify(tree); err != nil {
+		log.Error("Empty tree failed verification: %v", err)
+		t.Fail()
+	}
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		if err := Verify(tree); err != nil {
+			log.Error("Tree failed verification after inserting %v: %v", i, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestVerifyViolations(t *testing.T) {
+	allOk := true
+	check := func(tree LLRB, invariant string, key Key, path ...Key) {
+		err, ok := Verify(tree).(*InvariantError)
+		if !ok || err.Invariant != invariant || err.Key != key || len(err.Path) != len(path) {
+			log.Error("Expected violation of %v at %v on path %v, saw %v\n%v", invariant, key, path, err, tree)
+			allOk = false
+			return
+		}
+		for i, k := range path {
+			if err.Path[i] != k {
+				log.Error("Expected path %v, saw %v", path, err.Path)
+				allOk = false
+			}
+		}
+	}
+	genTree := func() LLRB {
+		tree := NewLLRB()
+		for i := 1; i <= 7; i++ {
+			tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		}
+		// 4 -> 2 -> (1, 3) and 4 -> 6 -> (5, 7), with 2, 5 and 7 red
+		return tree
+	}
+	{
+		tree := genTree()
+		tree.Root().SetColor(RED)
+		check(tree, InvariantBlackRoot, IntKey(4), IntKey(4))
+	}
+	{
+		tree := genTree()
+		tree.Root().Left().Right().SetKey(IntKey(5))
+		check(tree, InvariantOrdered, IntKey(5), IntKey(4), IntKey(2), IntKey(5))
+	}
+	{
+		tree := genTree()
+		tree.Root().Right().Left().SetColor(BLACK)
+		check(tree, InvariantLeftLeaning, IntKey(6), IntKey(4), IntKey(6))
+	}
+	{
+		tree := genTree()
+		tree.Root().Right().SetColor(RED)
+		check(tree, InvariantNoDoubleRed, IntKey(6), IntKey(4), IntKey(6))
+	}
+	{
+		tree := genTree()
+		tree.Root().Left().SetColor(BLACK)
+		check(tree, InvariantBlackBalance, IntKey(4), IntKey(4))
+	}
+	if !allOk {
+		t.Fail()
+	}
+}
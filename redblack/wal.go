@@ -0,0 +1,597 @@
+package redblack
+
+import "bufio"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "hash/crc32"
+import "io"
+import "os"
+import "path/filepath"
+import "sync"
+import "time"
+
+//=============================================================================
+//
+// Write-ahead logging
+//
+//=============================================================================
+
+/*
+A red-black tree that logs every change to a file before making it, so that
+its contents survive a crash.  Changes are buffered, and made durable by
+Commit, by the background commits requested in WALOptions, or by Close.
+
+Errors writing the log cannot be returned by Insert and the other methods
+changing the tree, so the first one is kept and returned by every later
+call to Commit, Snapshot or Close.  A change that cannot be logged is not
+made, and once the log is broken, or closed, no further changes are made.
+The tree is not safe for concurrent use, except that Commit may be called
+from any goroutine.  Clones are not logged.
+*/
+type WALTree interface {
+	LLRB
+	/*
+		Wait until every change made so far is durable; concurrent calls
+		share a single fsync of the log
+	*/
+	Commit() error
+	/*
+		Write the whole tree to a snapshot file and empty the log
+	*/
+	Snapshot() error
+	/*
+		Commit any outstanding changes and close the log; later calls
+		return an error
+	*/
+	Close() error
+}
+
+/*
+Options for OpenWAL
+*/
+type WALOptions struct {
+	/*
+		If not zero, commit outstanding changes in the background this
+		often, so no more than this much time's worth of changes can be
+		lost in a crash
+	*/
+	CommitInterval time.Duration
+	/*
+		If not zero, take a snapshot in the background this often, so the
+		log replayed by OpenWAL holds no more than this much time's worth
+		of changes
+	*/
+	SnapshotInterval time.Duration
+	/*
+		If not zero, take a snapshot once the log holds at least this many
+		bytes; checked by the background commits, so it needs a
+		CommitInterval too
+	*/
+	SnapshotLogSize int64
+}
+
+const (
+	walLogFile      = "wal.log"
+	walSnapshotFile = "wal.snapshot"
+)
+
+const (
+	walInsert = iota
+	walDelete
+	walDeleteRange
+	walClear
+)
+
+/*
+The largest record the log holds; longer lengths in a record header can only
+come from corruption, and are treated as the end of the log
+*/
+const walMaxRecord = 64 << 20
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errWALClosed = errors.New("log is closed")
+
+type walTree struct {
+	LLRB
+	dir  string
+	file *os.File
+	// guards the fields below, and changes to the tree
+	lock    sync.Mutex
+	synced  *sync.Cond
+	out     *bufio.Writer
+	logged  uint64
+	durable uint64
+	// bytes in the log, including any still buffered
+	size    int64
+	syncing bool
+	err     error
+	closed  bool
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+/*
+Open the log kept in dir, creating dir if needed, and restore the last
+snapshot and every change logged since into tree, which must be empty.  A
+partly written record at the end of the log, left by a crash, is discarded.
+*/
+func OpenWAL(dir string, tree LLRB, options WALOptions) (WALTree, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := readSnapshot(filepath.Join(dir, walSnapshotFile), tree); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, walLogFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	end, err := replay(file, tree)
+	if err == nil {
+		err = file.Truncate(end)
+	}
+	if err == nil {
+		_, err = file.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &walTree{LLRB: tree, dir: dir, file: file, out: bufio.NewWriter(file), size: end, stop: make(chan struct{})}
+	w.synced = sync.NewCond(&w.lock)
+	if options.CommitInterval > 0 || options.SnapshotInterval > 0 {
+		w.stopped.Add(1)
+		go w.background(options)
+	}
+	return w, nil
+}
+
+func (w *walTree) Insert(key Key, value Value) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.log(walInsert, key, value) {
+		w.LLRB.Insert(key, value)
+	}
+}
+
+func (w *walTree) Delete(key Key) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.log(walDelete, key) {
+		w.LLRB.Delete(key)
+	}
+}
+
+func (w *walTree) DeleteRange(low, high Key) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.log(walDeleteRange, low, high) {
+		return 0
+	}
+	return w.LLRB.DeleteRange(low, high)
+}
+
+func (w *walTree) DeleteMin() {
+	w.PopMin()
+}
+
+func (w *walTree) DeleteMax() {
+	w.PopMax()
+}
+
+func (w *walTree) PopMin() (Key, Value) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.Root() == nil {
+		return nil, nil
+	}
+	if !w.log(walDelete, w.Root().min()) {
+		return nil, nil
+	}
+	return w.LLRB.PopMin()
+}
+
+func (w *walTree) PopMax() (Key, Value) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.Root() == nil {
+		return nil, nil
+	}
+	if !w.log(walDelete, w.Root().max()) {
+		return nil, nil
+	}
+	return w.LLRB.PopMax()
+}
+
+func (w *walTree) UnmarshalJSON(data []byte) error {
+	decoded := NewLLRB()
+	if err := decoded.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	w.replace(decoded)
+	return nil
+}
+
+func (w *walTree) UnmarshalBinary(data []byte) error {
+	decoded := NewLLRB()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	w.replace(decoded)
+	return nil
+}
+
+func (w *walTree) SetRoot(h Node) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.logContents(h) {
+		w.LLRB.SetRoot(h)
+	}
+}
+
+/*
+Replace the contents of the tree with those of decoded, logging the change
+*/
+func (w *walTree) replace(decoded LLRB) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.logContents(decoded.Root()) {
+		return
+	}
+	w.LLRB.SetRoot(nil)
+	walk(decoded.Root(), func(h Node) {
+		w.LLRB.Insert(h.Key(), h.Value())
+	})
+}
+
+/*
+Log replacing the contents of the tree with the entries below h, returning
+false if they cannot all be logged
+*/
+func (w *walTree) logContents(h Node) bool {
+	clear, err := walRecord(walClear)
+	records := [][]byte{clear}
+	walk(h, func(h Node) {
+		var r []byte
+		if err == nil {
+			r, err = walRecord(walInsert, h.Key(), h.Value())
+			records = append(records, r)
+		}
+	})
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.write(records...)
+}
+
+func (w *walTree) Commit() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	target := w.logged
+	for w.durable < target && w.err == nil {
+		if w.syncing {
+			// another commit's fsync is under way; wait for it, then
+			// start another if it did not cover every record wanted
+			w.synced.Wait()
+			continue
+		}
+		w.syncing = true
+		logged := w.logged
+		err := w.out.Flush()
+		w.lock.Unlock()
+		if err == nil {
+			err = w.file.Sync()
+		}
+		w.lock.Lock()
+		w.syncing = false
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		if err == nil {
+			w.durable = logged
+		}
+		w.synced.Broadcast()
+	}
+	return w.err
+}
+
+func (w *walTree) Snapshot() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for w.syncing {
+		w.synced.Wait()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	data, err := w.LLRB.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err = writeSnapshot(w.dir, data); err != nil {
+		w.err = err
+		return err
+	}
+	// everything logged so far is in the snapshot, including any records
+	// still buffered, so they need never be written
+	w.out.Reset(w.file)
+	if err = w.file.Truncate(0); err == nil {
+		if _, err = w.file.Seek(0, io.SeekStart); err == nil {
+			err = w.file.Sync()
+		}
+	}
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.size = 0
+	w.durable = w.logged
+	w.synced.Broadcast()
+	return nil
+}
+
+func (w *walTree) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return errWALClosed
+	}
+	w.closed = true
+	w.lock.Unlock()
+	close(w.stop)
+	w.stopped.Wait()
+	err := w.Commit()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.lock.Lock()
+	if w.err == nil {
+		w.err = errWALClosed
+	}
+	w.lock.Unlock()
+	return err
+}
+
+/*
+Commit and take snapshots as often as options ask, until the tree is closed
+*/
+func (w *walTree) background(options WALOptions) {
+	defer w.stopped.Done()
+	var commits, snapshots <-chan time.Time
+	if options.CommitInterval > 0 {
+		ticker := time.NewTicker(options.CommitInterval)
+		defer ticker.Stop()
+		commits = ticker.C
+	}
+	if options.SnapshotInterval > 0 {
+		ticker := time.NewTicker(options.SnapshotInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+	for {
+		select {
+		case <-commits:
+			if options.SnapshotLogSize > 0 && w.logSize() >= options.SnapshotLogSize {
+				w.Snapshot()
+			} else {
+				w.Commit()
+			}
+		case <-snapshots:
+			w.Snapshot()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *walTree) logSize() int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.size
+}
+
+/*
+Append a record for a change to the log buffer, returning false if it could
+not be, so the change must not be made
+*/
+func (w *walTree) log(op byte, args ...interface{}) bool {
+	if w.err != nil {
+		return false
+	}
+	record, err := walRecord(op, args...)
+	if err != nil {
+		w.err = err
+		return false
+	}
+	return w.write(record)
+}
+
+/*
+Append records to the log buffer, returning false if the log is broken
+*/
+func (w *walTree) write(records ...[]byte) bool {
+	if w.err != nil {
+		return false
+	}
+	for _, record := range records {
+		if _, err := w.out.Write(record); err != nil {
+			w.err = err
+			return false
+		}
+		w.size += int64(len(record))
+		w.logged++
+	}
+	return true
+}
+
+/*
+Return a log record for a change; each record is its length and CRC-32C
+checksum as 4 byte big-endian integers, then the operation and its keys and
+values as written by appendBinary
+*/
+func walRecord(op byte, args ...interface{}) ([]byte, error) {
+	record := make([]byte, 8, 64)
+	record = append(record, op)
+	for _, arg := range args {
+		var err error
+		if record, err = appendBinary(record, arg); err != nil {
+			return nil, err
+		}
+	}
+	length := len(record) - 8
+	if length > walMaxRecord {
+		return nil, fmt.Errorf("log record of %v bytes exceeds limit of %v", length, walMaxRecord)
+	}
+	binary.BigEndian.PutUint32(record, uint32(length))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(record[8:], walTable))
+	return record, nil
+}
+
+/*
+Apply every complete record in the log to tree, returning the offset just
+past the last one
+*/
+func replay(file *os.File, tree LLRB) (int64, error) {
+	in := bufio.NewReader(file)
+	var end int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(in, header); err != nil {
+			// a missing or partial header is the end of the log
+			return end, nil
+		}
+		// every record holds at least its operation, so a zero length is
+		// not a record: a crash can leave the end of the file zeroed, as
+		// its size can reach the disk before its data does
+		length := binary.BigEndian.Uint32(header)
+		if length == 0 || length > walMaxRecord {
+			return end, nil
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(in, record); err != nil {
+			return end, nil
+		}
+		if crc32.Checksum(record, walTable) != binary.BigEndian.Uint32(header[4:]) {
+			return end, nil
+		}
+		if err := apply(record, tree); err != nil {
+			return 0, fmt.Errorf("log record at offset %v: %v", end, err)
+		}
+		end += int64(len(header) + len(record))
+	}
+}
+
+func apply(record []byte, tree LLRB) error {
+	if len(record) == 0 {
+		return errors.New("empty record")
+	}
+	op, data := record[0], record[1:]
+	args := make([]interface{}, 0, 2)
+	for len(data) > 0 {
+		var arg interface{}
+		var err error
+		if arg, data, err = readBinary(data); err != nil {
+			return err
+		}
+		args = append(args, arg)
+	}
+	keyAt := func(i int) (Key, error) {
+		if i >= len(args) {
+			return nil, errors.New("missing key")
+		}
+		key, ok := args[i].(Key)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a key", args[i])
+		}
+		return key, nil
+	}
+	switch op {
+	case walInsert:
+		if len(args) != 2 {
+			return errors.New("insert needs a key and value")
+		}
+		key, value, err := asEntry(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		tree.Insert(key, value)
+	case walDelete:
+		key, err := keyAt(0)
+		if err != nil {
+			return err
+		}
+		tree.Delete(key)
+	case walDeleteRange:
+		low, err := keyAt(0)
+		if err != nil {
+			return err
+		}
+		high, err := keyAt(1)
+		if err != nil {
+			return err
+		}
+		tree.DeleteRange(low, high)
+	case walClear:
+		tree.SetRoot(nil)
+	default:
+		return fmt.Errorf("unknown operation %v", op)
+	}
+	return nil
+}
+
+/*
+Snapshots hold a CRC-32C checksum as a 4 byte big-endian integer, followed
+by the tree as written by MarshalBinary
+*/
+func readSnapshot(path string, tree LLRB) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 || crc32.Checksum(data[4:], walTable) != binary.BigEndian.Uint32(data) {
+		return fmt.Errorf("corrupt snapshot %v", path)
+	}
+	return tree.UnmarshalBinary(data[4:])
+}
+
+/*
+Replace the snapshot in dir atomically, by writing a new one beside it and
+renaming it into place
+*/
+func writeSnapshot(dir string, data []byte) error {
+	path := filepath.Join(dir, walSnapshotFile)
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	checksum := binary.BigEndian.AppendUint32(nil, crc32.Checksum(data, walTable))
+	if _, err = file.Write(append(checksum, data...)); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,303 @@
+package redblack
+
+import "os"
+import "path/filepath"
+import "sync"
+import "testing"
+import "time"
+
+func TestWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tree.Insert(IntKey(50), StringValue("changed"))
+	tree.Delete(IntKey(1))
+	tree.DeleteRange(IntKey(10), IntKey(19))
+	tree.PopMin()
+	tree.DeleteMax()
+	if err := tree.Close(); err != nil {
+		log.Error("Failed closing log: %v", err)
+		t.FailNow()
+	}
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if !checkSameContents(tree, replayed) || !checkBalance(replayed) || replayed.Size() != 87 {
+		log.Error("Expected 87 keys replayed from log, saw %v", replayed.Size())
+		t.Fail()
+	}
+	if replayed.Search(IntKey(50)).String() != "changed" {
+		log.Error("Expected replayed value for 50 to be changed, saw %v", replayed.Search(IntKey(50)))
+		t.Fail()
+	}
+}
+
+func TestWALTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	for i := 1; i <= 10; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	tree.Close()
+	path := filepath.Join(dir, walLogFile)
+	info, _ := os.Stat(path)
+	// cut the last record short, as a crash partway through writing would
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		log.Error("Failed truncating log: %v", err)
+		t.FailNow()
+	}
+	replayed := openWAL(t, dir, WALOptions{})
+	if replayed.Size() != 9 || replayed.Search(IntKey(10)) != nil {
+		log.Error("Expected 9 keys before torn record, saw %v", replayed.Size())
+		t.Fail()
+	}
+	replayed.Insert(IntKey(11), StringValue("11"))
+	replayed.Close()
+	again := openWAL(t, dir, WALOptions{})
+	defer again.Close()
+	if again.Size() != 10 || again.Search(IntKey(11)) == nil {
+		log.Error("Expected records after torn record to be kept, saw %v keys", again.Size())
+		t.Fail()
+	}
+}
+
+func TestWALCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	tree.Insert(IntKey(1), StringValue("one"))
+	tree.Insert(IntKey(2), StringValue("two"))
+	tree.Close()
+	path := filepath.Join(dir, walLogFile)
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if replayed.Size() != 1 || replayed.Search(IntKey(2)) != nil {
+		log.Error("Expected only the record before the corrupt one, saw %v keys", replayed.Size())
+		t.Fail()
+	}
+}
+
+func TestWALZeroedTail(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	tree.Insert(IntKey(1), StringValue("one"))
+	tree.Insert(IntKey(2), StringValue("two"))
+	tree.Close()
+	path := filepath.Join(dir, walLogFile)
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write(make([]byte, 4096))
+	file.Close()
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if replayed.Size() != 2 {
+		log.Error("Expected 2 keys before zeroed tail, saw %v", replayed.Size())
+		t.Fail()
+	}
+	if info, _ := os.Stat(path); info.Size() >= 4096 {
+		log.Error("Expected zeroed tail to be truncated, log is %v bytes", info.Size())
+		t.Fail()
+	}
+}
+
+func TestWALOversizedRecord(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	tree.Insert(IntKey(1), StringValue("one"))
+	tree.Close()
+	path := filepath.Join(dir, walLogFile)
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	// a header claiming a 4GiB record
+	file.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	file.Close()
+	replayed := openWAL(t, dir, WALOptions{})
+	if replayed.Size() != 1 {
+		log.Error("Expected 1 key before oversized record, saw %v", replayed.Size())
+		t.Fail()
+	}
+	replayed.Insert(IntKey(2), BytesValue(make([]byte, walMaxRecord)))
+	if err := replayed.Commit(); err == nil {
+		log.Error("Expected error logging oversized record")
+		t.Fail()
+	}
+	replayed.Close()
+}
+
+func TestWALSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	for i := 1; i <= 100; i++ {
+		tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+	}
+	if err := tree.Snapshot(); err != nil {
+		log.Error("Failed taking snapshot: %v", err)
+		t.FailNow()
+	}
+	if info, err := os.Stat(filepath.Join(dir, walLogFile)); err != nil || info.Size() != 0 {
+		log.Error("Expected empty log after snapshot, saw %v (%v)", info.Size(), err)
+		t.Fail()
+	}
+	tree.Delete(IntKey(5))
+	tree.Insert(IntKey(200), StringValue("200"))
+	if err := tree.Commit(); err != nil {
+		log.Error("Failed committing: %v", err)
+		t.Fail()
+	}
+	// reopen without closing, as after a crash
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if !checkSameContents(tree, replayed) || replayed.Size() != 100 {
+		log.Error("Expected snapshot and log to restore 100 keys, saw %v", replayed.Size())
+		t.Fail()
+	}
+	tree.Close()
+}
+
+func TestWALUnmarshal(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	tree.Insert(IntKey(1), StringValue("gone"))
+	data, _ := genMixedTree().MarshalBinary()
+	if err := tree.UnmarshalBinary(data); err != nil {
+		log.Error("Failed unmarshaling: %v", err)
+		t.FailNow()
+	}
+	tree.Close()
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if !checkSameContents(genMixedTree(), replayed) {
+		t.Fail()
+	}
+}
+
+func TestWALGroupCommit(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{CommitInterval: time.Millisecond})
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wait.Add(1)
+		go func(g int) {
+			defer wait.Done()
+			for i := 0; i < 50; i++ {
+				mutex.Lock()
+				tree.Insert(IntKey(g*100+i), StringValue("value"))
+				mutex.Unlock()
+				if err := tree.Commit(); err != nil {
+					log.Error("Failed committing: %v", err)
+					t.Fail()
+				}
+			}
+		}(g)
+	}
+	wait.Wait()
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if replayed.Size() != 400 {
+		log.Error("Expected 400 committed keys, saw %v", replayed.Size())
+		t.Fail()
+	}
+	tree.Insert(IntKey(-1), StringValue("background"))
+	time.Sleep(50 * time.Millisecond)
+	if info, _ := os.Stat(filepath.Join(dir, walLogFile)); info.Size() == 0 {
+		log.Error("Expected background commit to write the log")
+		t.Fail()
+	}
+	tree.Close()
+}
+
+func TestWALSetRoot(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	tree.Insert(IntKey(1), StringValue("gone"))
+	tree.SetRoot(genMixedTree().Root())
+	tree.Close()
+	replayed := openWAL(t, dir, WALOptions{})
+	defer replayed.Close()
+	if !checkSameContents(genMixedTree(), replayed) {
+		log.Error("Expected SetRoot to be logged")
+		t.Fail()
+	}
+}
+
+func TestWALBroken(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{})
+	tree.Insert(IntKey(1), StringValue("one"))
+	tree.Insert(IntKey(2), unregisteredValue{})
+	tree.Insert(IntKey(3), StringValue("three"))
+	tree.Delete(IntKey(1))
+	if tree.Size() != 1 || tree.Search(IntKey(1)) == nil {
+		log.Error("Expected no changes after the log broke, saw %v keys", tree.Size())
+		t.Fail()
+	}
+	if err := tree.Commit(); err == nil {
+		log.Error("Expected error committing a broken log")
+		t.Fail()
+	}
+	tree.Close()
+}
+
+func TestWALClose(t *testing.T) {
+	dir := t.TempDir()
+	tree := openWAL(t, dir, WALOptions{CommitInterval: time.Millisecond})
+	tree.Insert(IntKey(1), StringValue("one"))
+	if err := tree.Close(); err != nil {
+		log.Error("Failed closing log: %v", err)
+		t.Fail()
+	}
+	if err := tree.Close(); err == nil {
+		log.Error("Expected error closing log twice")
+		t.Fail()
+	}
+	tree.Insert(IntKey(2), StringValue("two"))
+	if tree.Size() != 1 {
+		log.Error("Expected no changes after closing, saw %v keys", tree.Size())
+		t.Fail()
+	}
+}
+
+func TestWALBackgroundSnapshot(t *testing.T) {
+	for _, options := range []WALOptions{
+		{SnapshotInterval: time.Millisecond},
+		{CommitInterval: time.Millisecond, SnapshotLogSize: 1000},
+	} {
+		dir := t.TempDir()
+		tree := openWAL(t, dir, options)
+		for i := 1; i <= 100; i++ {
+			tree.Insert(IntKey(i), StringValue(IntKey(i).String()))
+		}
+		time.Sleep(50 * time.Millisecond)
+		if _, err := os.Stat(filepath.Join(dir, walSnapshotFile)); err != nil {
+			log.Error("Expected background snapshot with %+v: %v", options, err)
+			t.Fail()
+		}
+		if info, _ := os.Stat(filepath.Join(dir, walLogFile)); info.Size() >= 1000 {
+			log.Error("Expected snapshot to empty log with %+v, log is %v bytes", options, info.Size())
+			t.Fail()
+		}
+		tree.Close()
+		replayed := openWAL(t, dir, WALOptions{})
+		if !checkSameContents(tree, replayed) {
+			t.Fail()
+		}
+		replayed.Close()
+	}
+}
+
+//=============================================================================
+//
+// Utility methods
+//
+//=============================================================================
+
+func openWAL(t *testing.T, dir string, options WALOptions) WALTree {
+	tree, err := OpenWAL(dir, NewLLRB(), options)
+	if err != nil {
+		log.Error("Failed opening log in %v: %v", dir, err)
+		t.FailNow()
+	}
+	return tree
+}